@@ -0,0 +1,28 @@
+package handler
+
+import (
+    "net/http"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+func (h *handler) lastCountersReconciliation(w http.ResponseWriter, r *http.Request) {
+    cr, err := h.LastCountersReconciliation(r.Context())
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrForbidden {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    if cr == nil {
+        w.WriteHeader(http.StatusNoContent)
+        return
+    }
+    respond(w, cr, http.StatusOK)
+}
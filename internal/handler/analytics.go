@@ -0,0 +1,48 @@
+package handler
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/matryer/way"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+func (h *handler) postAnalytics(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    a, err := h.PostAnalytics(ctx, postID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrForbiddenPostAnalytics {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, a, http.StatusOK)
+}
+
+func (h *handler) recordProfileClick(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    err := h.RecordProfileClick(ctx, postID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/matryer/way"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+func (h *handler) bookmark(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    response, err := h.Bookmark(ctx, postID)
+    respondBookmark(w, response, err)
+}
+
+func (h *handler) deleteBookmark(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    response, err := h.DeleteBookmark(ctx, postID)
+    respondBookmark(w, response, err)
+}
+
+func respondBookmark(w http.ResponseWriter, response service.BookmarkResponse, err error) {
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, response, http.StatusOK)
+}
+
+func (h *handler) bookmarks(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    pp, err := h.Bookmarks(r.Context(), last, before)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, pp, http.StatusOK)
+}
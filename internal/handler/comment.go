@@ -33,6 +33,10 @@ func (h *handler) createComment(w http.ResponseWriter, r *http.Request) {
         return
 
     }
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
 
     if err != nil {
         respondError(w, err)
@@ -61,6 +65,23 @@ func (h *handler) toggleCommentLike(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (h *handler) commentLikes(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    commentID, _ := strconv.ParseInt(way.Param(ctx, "comment_id"), 10, 64)
+    first, _ := strconv.Atoi(q.Get("first"))
+    uu, err := h.CommentLikes(ctx, commentID, first, q.Get("after"))
+    if err == service.ErrCommentNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, uu, http.StatusOK)
+}
+
 func (h *handler) comments(w http.ResponseWriter, r *http.Request) {
     if a, _, err := mime.ParseMediaType(r.Header.Get("Accept")); err == nil && a == "text/event-stream" {
         h.subscribeToComments(w, r)
@@ -73,6 +94,10 @@ func (h *handler) comments(w http.ResponseWriter, r *http.Request) {
     last, _ := strconv.Atoi(q.Get("last"))
     before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
     cc, err := h.Comments(ctx, postID, last, before)
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
     if err != nil {
         respondError(w, err)
         return
@@ -87,12 +112,21 @@ func (h *handler) subscribeToComments(w http.ResponseWriter, r *http.Request) {
     }
     ctx := r.Context()
     postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    cc, err := h.SubscribeToComments(ctx, postID)
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
 
     header := w.Header()
     header.Set("Cache-Control", "no-cache")
     header.Set("Connection", "keep-alive")
     header.Set("Content-Type", "text/event-stream")
-    for c := range h.SubscribeToComments(ctx, postID) {
+    for c := range cc {
         writeSSe(w, c)
         f.Flush()
     }
@@ -0,0 +1,184 @@
+package handler
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+
+    "github.com/matryer/way"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+type draftInput struct {
+    Content   string
+    SpoilerOf *string `json:"spoiler_of"`
+    NSFW      bool
+    MediaIDs  []int64 `json:"media_ids"`
+    Version   int
+}
+
+type publishDraftInput struct {
+    Version int
+}
+
+func (h *handler) createDraft(w http.ResponseWriter, r *http.Request) {
+    var input draftInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    d, err := h.CreateDraft(r.Context(), service.DraftInput{
+        Content:   input.Content,
+        SpoilerOf: input.SpoilerOf,
+        NSFW:      input.NSFW,
+        MediaIDs:  input.MediaIDs,
+    })
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler || err == service.ErrTooManyMedia ||
+        err == service.ErrMediaNotFound || err == service.ErrTooManyDrafts {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, d, http.StatusCreated)
+}
+
+func (h *handler) drafts(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    dd, err := h.Drafts(r.Context(), last, before)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, dd, http.StatusOK)
+}
+
+func (h *handler) draft(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    draftID, _ := strconv.ParseInt(way.Param(ctx, "draft_id"), 10, 64)
+    d, err := h.Draft(ctx, draftID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrDraftNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, d, http.StatusOK)
+}
+
+func (h *handler) updateDraft(w http.ResponseWriter, r *http.Request) {
+    var input draftInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    ctx := r.Context()
+    draftID, _ := strconv.ParseInt(way.Param(ctx, "draft_id"), 10, 64)
+    d, err := h.UpdateDraft(ctx, draftID, input.Version, service.DraftInput{
+        Content:   input.Content,
+        SpoilerOf: input.SpoilerOf,
+        NSFW:      input.NSFW,
+        MediaIDs:  input.MediaIDs,
+    })
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler || err == service.ErrTooManyMedia ||
+        err == service.ErrMediaNotFound {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err == service.ErrDraftNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrDraftVersionConflict {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, d, http.StatusOK)
+}
+
+func (h *handler) deleteDraft(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    draftID, _ := strconv.ParseInt(way.Param(ctx, "draft_id"), 10, 64)
+    version, _ := strconv.Atoi(r.URL.Query().Get("version"))
+    err := h.DeleteDraft(ctx, draftID, version)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrDraftNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrDraftVersionConflict {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) publishDraft(w http.ResponseWriter, r *http.Request) {
+    var input publishDraftInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    ctx := r.Context()
+    draftID, _ := strconv.ParseInt(way.Param(ctx, "draft_id"), 10, 64)
+    ti, err := h.PublishDraft(ctx, draftID, input.Version)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler || err == service.ErrTooManyMedia ||
+        err == service.ErrMediaNotFound {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err == service.ErrDraftNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrDraftVersionConflict {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, ti, http.StatusCreated)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/matryer/way"
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+type importFolloweesInput struct {
+    Usernames []string
+}
+
+func (h *handler) exportFollowees(w http.ResponseWriter, r *http.Request) {
+    ff, err := h.ExportFollowees(r.Context())
+    respondFollowsExport(w, r, "followees", ff, err)
+}
+
+func (h *handler) exportFollowers(w http.ResponseWriter, r *http.Request) {
+    ff, err := h.ExportFollowers(r.Context())
+    respondFollowsExport(w, r, "followers", ff, err)
+}
+
+func respondFollowsExport(w http.ResponseWriter, r *http.Request, name string, ff []service.FollowExport, err error) {
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    if r.URL.Query().Get("format") != "csv" {
+        respond(w, ff, http.StatusOK)
+        return
+    }
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", "attachment; filename="+name+".csv")
+    cw := csv.NewWriter(w)
+    cw.Write([]string{"username", "followed_at"})
+    for _, f := range ff {
+        cw.Write([]string{f.Username, f.FollowedAt.Format(time.RFC3339)})
+    }
+    cw.Flush()
+}
+
+func (h *handler) importFollowees(w http.ResponseWriter, r *http.Request) {
+    var in importFolloweesInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    fi, err := h.ImportFollowees(r.Context(), in.Usernames)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidFollowImport {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, fi, http.StatusAccepted)
+}
+
+func (h *handler) followImport(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    importID, _ := strconv.ParseInt(way.Param(ctx, "import_id"), 10, 64)
+    fi, err := h.FollowImport(ctx, importID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrFollowImportNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, fi, http.StatusOK)
+}
@@ -21,27 +21,76 @@ func New(s *service.Service) http.Handler {
     api.HandleFunc("GET", "/user", h.authUser)
     api.HandleFunc("POST", "/users/:username/toggle_follow", h.toggleFollow)
     api.HandleFunc("PUT", "/user/avatar", h.updateAvatar)
+    api.HandleFunc("GET", "/user/content_preferences", h.contentPreferences)
+    api.HandleFunc("PUT", "/user/content_preferences", h.updateContentPreferences)
+    api.HandleFunc("GET", "/user/followees/export", h.exportFollowees)
+    api.HandleFunc("GET", "/user/followers/export", h.exportFollowers)
+    api.HandleFunc("POST", "/user/followees/import", h.importFollowees)
+    api.HandleFunc("GET", "/user/follow_imports/:import_id", h.followImport)
     api.HandleFunc("POST", "/users", h.createUser)
     api.HandleFunc("GET", "/users", h.users)
     api.HandleFunc("GET", "/users/:username", h.user)
     api.HandleFunc("GET", "/users/:username/followers", h.followers)
     api.HandleFunc("GET", "/users/:username/posts", h.posts)
     api.HandleFunc("GET", "/users/:username/followees", h.followees)
+    api.HandleFunc("GET", "/users/:username/lists", h.lists)
 
     api.HandleFunc("POST", "/posts", h.createPost)
+    api.HandleFunc("POST", "/media", h.uploadMedia)
+    api.HandleFunc("GET", "/bookmarks", h.bookmarks)
+    api.HandleFunc("POST", "/drafts", h.createDraft)
+    api.HandleFunc("GET", "/drafts", h.drafts)
+    api.HandleFunc("GET", "/drafts/:draft_id", h.draft)
+    api.HandleFunc("PATCH", "/drafts/:draft_id", h.updateDraft)
+    api.HandleFunc("DELETE", "/drafts/:draft_id", h.deleteDraft)
+    api.HandleFunc("POST", "/drafts/:draft_id/publish", h.publishDraft)
+    api.HandleFunc("GET", "/scheduled_posts", h.scheduledPosts)
+    api.HandleFunc("PATCH", "/scheduled_posts/:scheduled_post_id", h.updateScheduledPost)
+    api.HandleFunc("DELETE", "/scheduled_posts/:scheduled_post_id", h.cancelScheduledPost)
     api.HandleFunc("GET", "/posts/:post_id", h.post)
+    api.HandleFunc("PATCH", "/posts/:post_id", h.updatePost)
+    api.HandleFunc("DELETE", "/posts/:post_id", h.deletePost)
+    api.HandleFunc("GET", "/posts/:post_id/history", h.postHistory)
+    api.HandleFunc("GET", "/posts/:post_id/quotes", h.quotes)
+    api.HandleFunc("GET", "/posts/:post_id/analytics", h.postAnalytics)
+    api.HandleFunc("POST", "/posts/:post_id/profile_click", h.recordProfileClick)
+    api.HandleFunc("GET", "/posts/:post_id/thread", h.thread)
+    api.HandleFunc("POST", "/posts/:post_id/poll/vote", h.votePoll)
     api.HandleFunc("POST", "/posts/:post_id/toggle_like", h.togglePostLike)
+    api.HandleFunc("GET", "/posts/:post_id/likes", h.postLikes)
+    api.HandleFunc("POST", "/posts/:post_id/repost", h.repost)
+    api.HandleFunc("POST", "/posts/:post_id/bookmark", h.bookmark)
+    api.HandleFunc("DELETE", "/posts/:post_id/bookmark", h.deleteBookmark)
+    api.HandleFunc("DELETE", "/posts/:post_id/repost", h.deleteRepost)
     api.HandleFunc("POST", "/posts/:post_id/comments", h.createComment)
     api.HandleFunc("GET", "/posts/:post_id/comments", h.comments)
 
     api.HandleFunc("POST", "/comments/:comment_id/toggle_like", h.toggleCommentLike)
+    api.HandleFunc("GET", "/comments/:comment_id/likes", h.commentLikes)
     api.HandleFunc("GET", "/timeline", h.timeline)
     api.HandleFunc("POST", "/posts/:post_id/toggle_subscription", h.togglePostSubscription)
+    api.HandleFunc("POST", "/posts/:post_id/toggle_pin", h.togglePostPin)
+
+    api.HandleFunc("POST", "/lists", h.createList)
+    api.HandleFunc("GET", "/lists/:list_id", h.list)
+    api.HandleFunc("DELETE", "/lists/:list_id", h.deleteList)
+    api.HandleFunc("GET", "/lists/:list_id/members", h.listMembers)
+    api.HandleFunc("POST", "/lists/:list_id/members", h.addListMember)
+    api.HandleFunc("DELETE", "/lists/:list_id/members/:username", h.removeListMember)
+    api.HandleFunc("POST", "/lists/:list_id/toggle_subscription", h.toggleListSubscription)
+    api.HandleFunc("GET", "/lists/:list_id/timeline", h.listTimeline)
+
+    api.HandleFunc("GET", "/hashtags/:tag", h.hashtag)
+    api.HandleFunc("GET", "/hashtags/:tag/posts", h.hashtagPosts)
+    api.HandleFunc("GET", "/trends", h.trends)
+    api.HandleFunc("GET", "/search/posts", h.searchPosts)
 
     api.HandleFunc("GET", "/notifications", h.notifications)
     api.HandleFunc("POST", "/notifications/:notification_id/mark_as_read", h.markNotificationAsRead)
     api.HandleFunc("POST", "/mark_notifications_as_read", h.markAllNotificationsAsRead)
 
+    api.HandleFunc("GET", "/admin/counters_reconciliation", h.lastCountersReconciliation)
+
     fs := http.FileServer(&spaFileSystem{http.Dir("public")})
     r := way.NewRouter()
     r.Handle("*", "/api...", http.StripPrefix("/api", h.withAuth(api)))
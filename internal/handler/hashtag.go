@@ -0,0 +1,44 @@
+package handler
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/matryer/way"
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+func (h *handler) hashtag(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    t, err := h.Hashtag(ctx, way.Param(ctx, "tag"))
+    if err == service.ErrInvalidHashtag {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err == service.ErrHashtagNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, t, http.StatusOK)
+}
+
+func (h *handler) hashtagPosts(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    pp, err := h.HashtagPosts(ctx, way.Param(ctx, "tag"), last, before)
+    if err == service.ErrInvalidHashtag {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, pp, http.StatusOK)
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+    "encoding/json"
+    "mime"
+    "net/http"
+    "strconv"
+
+    "github.com/matryer/way"
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+type createListInput struct {
+    Name    string
+    Private bool
+}
+
+type addListMemberInput struct {
+    Username string
+}
+
+func (h *handler) createList(w http.ResponseWriter, r *http.Request) {
+    var in createListInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    l, err := h.CreateList(r.Context(), in.Name, in.Private)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidListName {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, l, http.StatusCreated)
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    l, err := h.List(ctx, listID)
+    if err == service.ErrListNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, l, http.StatusOK)
+}
+
+func (h *handler) lists(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    ll, err := h.Lists(ctx, way.Param(ctx, "username"), last, before)
+    if err == service.ErrInvalidUsername {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, ll, http.StatusOK)
+}
+
+func (h *handler) deleteList(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    err := h.DeleteList(ctx, listID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrListNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrForbiddenListAccess {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) listMembers(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    first, _ := strconv.Atoi(q.Get("first"))
+    uu, err := h.ListMembers(ctx, listID, first, q.Get("after"))
+    if err == service.ErrListNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, uu, http.StatusOK)
+}
+
+func (h *handler) addListMember(w http.ResponseWriter, r *http.Request) {
+    var in addListMemberInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    ctx := r.Context()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    err := h.AddListMember(ctx, listID, in.Username)
+    respondListMemberChange(w, err)
+}
+
+func (h *handler) removeListMember(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    err := h.RemoveListMember(ctx, listID, way.Param(ctx, "username"))
+    respondListMemberChange(w, err)
+}
+
+func respondListMemberChange(w http.ResponseWriter, err error) {
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidUsername {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err == service.ErrListNotFound || err == service.ErrUserNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrForbiddenListAccess {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) toggleListSubscription(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    out, err := h.ToggleListSubscription(ctx, listID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrListNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrForbiddenListSubscription {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, out, http.StatusOK)
+}
+
+func (h *handler) listTimeline(w http.ResponseWriter, r *http.Request) {
+    if a, _, err := mime.ParseMediaType(r.Header.Get("Accept")); err == nil && a == "text/event-stream" {
+        h.subscribeToListTimeline(w, r)
+        return
+    }
+    ctx := r.Context()
+    q := r.URL.Query()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    pp, err := h.ListTimeline(ctx, listID, last, before)
+    if err == service.ErrListNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, pp, http.StatusOK)
+}
+
+func (h *handler) subscribeToListTimeline(w http.ResponseWriter, r *http.Request) {
+    f, ok := w.(http.Flusher)
+    if !ok {
+        respondError(w, errStreamingUnsupported)
+        return
+    }
+    ctx := r.Context()
+    listID, _ := strconv.ParseInt(way.Param(ctx, "list_id"), 10, 64)
+    tt, err := h.SubscribeToListTimeline(ctx, listID)
+    if err == service.ErrListNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    header := w.Header()
+    header.Set("Cache-Control", "no-cache")
+    header.Set("Connection", "keep-alive")
+    header.Set("Content-Type", "text/event-stream")
+    for ti := range tt {
+        writeSSe(w, ti)
+        f.Flush()
+    }
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+    "net/http"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+func (h *handler) uploadMedia(w http.ResponseWriter, r *http.Request) {
+    r.Body = http.MaxBytesReader(w, r.Body, service.MaxMediaBytes)
+    defer r.Body.Close()
+    m, err := h.UploadMedia(r.Context(), r.Body, r.URL.Query().Get("alt_text"))
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrUnsupportedMediaFormat {
+        http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+        return
+    }
+    if err == service.ErrMediaTooLarge {
+        http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+        return
+    }
+    if err == service.ErrInvalidMediaAltText {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, m, http.StatusCreated)
+}
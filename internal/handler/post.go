@@ -4,6 +4,7 @@ import (
     "encoding/json"
     "net/http"
     "strconv"
+    "time"
 
     "github.com/matryer/way"
 
@@ -11,9 +12,30 @@ import (
 )
 
 type createPostInput struct {
-    Content   string
+    Content         string
+    SpoilerOf       *string
+    NSFW            bool
+    QuotedPostID    *int64     `json:"quoted_post_id"`
+    InReplyToPostID *int64     `json:"in_reply_to_post_id"`
+    MediaIDs        []int64    `json:"media_ids"`
+    Poll            *pollInput `json:"poll"`
+    Visibility      string
+    PublishAt       *time.Time `json:"publish_at"`
+}
+
+type pollInput struct {
+    Options         []string
+    DurationMinutes int `json:"duration_minutes"`
+}
+
+type votePollInput struct {
+    OptionID int64 `json:"option_id"`
+}
+
+type updatePostInput struct {
+    Content   *string
     SpoilerOf *string
-    NSFW      bool
+    NSFW      *bool
 }
 
 func (h *handler) post(w http.ResponseWriter, r *http.Request) {
@@ -46,6 +68,42 @@ func (h *handler) posts(w http.ResponseWriter, r *http.Request) {
     }
     respond(w, pp, http.StatusOK)
 }
+
+func (h *handler) quotes(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    pp, err := h.Quotes(ctx, postID, last, before)
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, pp, http.StatusOK)
+}
+
+func (h *handler) thread(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    first, _ := strconv.Atoi(q.Get("first"))
+    after, _ := strconv.ParseInt(q.Get("after"), 10, 64)
+    t, err := h.Thread(ctx, postID, first, after)
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, t, http.StatusOK)
+}
 func (h *handler) togglePostLike(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
     postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
@@ -65,6 +123,23 @@ func (h *handler) togglePostLike(w http.ResponseWriter, r *http.Request) {
     respond(w, response, http.StatusOK)
 }
 
+func (h *handler) postLikes(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    first, _ := strconv.Atoi(q.Get("first"))
+    uu, err := h.PostLikes(ctx, postID, first, q.Get("after"))
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, uu, http.StatusOK)
+}
+
 func (h *handler) createPost(w http.ResponseWriter, r *http.Request) {
     var input createPostInput
     defer r.Body.Close()
@@ -72,12 +147,28 @@ func (h *handler) createPost(w http.ResponseWriter, r *http.Request) {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
-    ti, err := h.CreatePost(r.Context(), input.Content, input.SpoilerOf, input.NSFW)
+    in := service.CreatePostInput{
+        Content:         input.Content,
+        SpoilerOf:       input.SpoilerOf,
+        NSFW:            input.NSFW,
+        QuotedPostID:    input.QuotedPostID,
+        InReplyToPostID: input.InReplyToPostID,
+        MediaIDs:        input.MediaIDs,
+        Poll:            input.Poll.toService(),
+        Visibility:      input.Visibility,
+    }
+    if input.PublishAt != nil {
+        h.schedulePost(w, r, in, *input.PublishAt)
+        return
+    }
+    ti, err := h.CreatePost(r.Context(), in)
     if err == service.ErrUnauthenticated {
         http.Error(w, err.Error(), http.StatusUnauthorized)
         return
     }
-    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler {
+    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler || err == service.ErrQuotedPostNotFound ||
+        err == service.ErrRepliedPostNotFound || err == service.ErrTooManyMedia || err == service.ErrMediaNotFound ||
+        err == service.ErrInvalidPoll || err == service.ErrInvalidVisibility {
         http.Error(w, err.Error(), http.StatusUnprocessableEntity)
         return
     }
@@ -88,6 +179,173 @@ func (h *handler) createPost(w http.ResponseWriter, r *http.Request) {
     respond(w, ti, http.StatusCreated)
 }
 
+func (in *pollInput) toService() *service.PollInput {
+    if in == nil {
+        return nil
+    }
+    return &service.PollInput{Options: in.Options, DurationMinutes: in.DurationMinutes}
+}
+
+func (h *handler) votePoll(w http.ResponseWriter, r *http.Request) {
+    var input votePollInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    poll, err := h.VotePoll(ctx, postID, input.OptionID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrPostNotFound || err == service.ErrPollNotFound || err == service.ErrPollOptionNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrPollClosed || err == service.ErrAlreadyVoted {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, poll, http.StatusOK)
+}
+
+func (h *handler) updatePost(w http.ResponseWriter, r *http.Request) {
+    var input updatePostInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    p, err := h.UpdatePost(ctx, postID, service.UpdatePostInput{
+        Content:   input.Content,
+        SpoilerOf: input.SpoilerOf,
+        NSFW:      input.NSFW,
+    })
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrForbiddenPostEdit || err == service.ErrPostEditWindowExpired {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, p, http.StatusOK)
+}
+
+func (h *handler) deletePost(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    err := h.DeletePost(ctx, postID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrForbiddenPostDelete {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) postHistory(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    q := r.URL.Query()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    ee, err := h.PostHistory(ctx, postID, last, before)
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, ee, http.StatusOK)
+}
+
+func (h *handler) repost(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    response, err := h.Repost(ctx, postID)
+    respondRepost(w, response, err)
+}
+
+func (h *handler) deleteRepost(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    response, err := h.DeleteRepost(ctx, postID)
+    respondRepost(w, response, err)
+}
+
+func respondRepost(w http.ResponseWriter, response service.RepostResponse, err error) {
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, response, http.StatusOK)
+}
+
+func (h *handler) togglePostPin(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
+    out, err := h.TogglePostPin(ctx, postID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err == service.ErrForbiddenPin {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, out, http.StatusOK)
+}
+
 func (h *handler) togglePostSubscription(w http.ResponseWriter, r *http.Request) {
  	ctx := r.Context()
  	postID, _ := strconv.ParseInt(way.Param(ctx, "post_id"), 10, 64)
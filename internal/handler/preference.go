@@ -0,0 +1,52 @@
+package handler
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+type contentPreferencesInput struct {
+    NSFW           string
+    ExpandSpoilers bool `json:"expand_spoilers"`
+}
+
+func (h *handler) contentPreferences(w http.ResponseWriter, r *http.Request) {
+    prefs, err := h.ContentPreferences(r.Context())
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, prefs, http.StatusOK)
+}
+
+func (h *handler) updateContentPreferences(w http.ResponseWriter, r *http.Request) {
+    var input contentPreferencesInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    prefs, err := h.UpdateContentPreferences(r.Context(), service.ContentPreferences{
+        NSFW:           input.NSFW,
+        ExpandSpoilers: input.ExpandSpoilers,
+    })
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidNSFWPreference {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, prefs, http.StatusOK)
+}
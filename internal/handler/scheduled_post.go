@@ -0,0 +1,118 @@
+package handler
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/matryer/way"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+type scheduledPostInput struct {
+    Content         string
+    SpoilerOf       *string    `json:"spoiler_of"`
+    NSFW            bool
+    QuotedPostID    *int64     `json:"quoted_post_id"`
+    InReplyToPostID *int64     `json:"in_reply_to_post_id"`
+    MediaIDs        []int64    `json:"media_ids"`
+    Poll            *pollInput `json:"poll"`
+    Visibility      string
+    PublishAt       time.Time  `json:"publish_at"`
+}
+
+func (h *handler) schedulePost(w http.ResponseWriter, r *http.Request, in service.CreatePostInput, publishAt time.Time) {
+    sp, err := h.SchedulePost(r.Context(), in, publishAt)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler || err == service.ErrQuotedPostNotFound ||
+        err == service.ErrRepliedPostNotFound || err == service.ErrTooManyMedia || err == service.ErrMediaNotFound ||
+        err == service.ErrInvalidPublishAt || err == service.ErrInvalidPoll || err == service.ErrInvalidVisibility {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, sp, http.StatusCreated)
+}
+
+func (h *handler) scheduledPosts(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    first, _ := strconv.Atoi(q.Get("first"))
+    after, _ := strconv.ParseInt(q.Get("after"), 10, 64)
+    spp, err := h.ScheduledPosts(r.Context(), first, after)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, spp, http.StatusOK)
+}
+
+func (h *handler) updateScheduledPost(w http.ResponseWriter, r *http.Request) {
+    var input scheduledPostInput
+    defer r.Body.Close()
+    if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    ctx := r.Context()
+    scheduledPostID, _ := strconv.ParseInt(way.Param(ctx, "scheduled_post_id"), 10, 64)
+    sp, err := h.UpdateScheduledPost(ctx, scheduledPostID, service.CreatePostInput{
+        Content:         input.Content,
+        SpoilerOf:       input.SpoilerOf,
+        NSFW:            input.NSFW,
+        QuotedPostID:    input.QuotedPostID,
+        InReplyToPostID: input.InReplyToPostID,
+        MediaIDs:        input.MediaIDs,
+        Poll:            input.Poll.toService(),
+        Visibility:      input.Visibility,
+    }, input.PublishAt)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidContent || err == service.ErrInvalidSpoiler || err == service.ErrQuotedPostNotFound ||
+        err == service.ErrRepliedPostNotFound || err == service.ErrTooManyMedia || err == service.ErrMediaNotFound ||
+        err == service.ErrInvalidPublishAt || err == service.ErrInvalidPoll || err == service.ErrInvalidVisibility {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err == service.ErrScheduledPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, sp, http.StatusOK)
+}
+
+func (h *handler) cancelScheduledPost(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    scheduledPostID, _ := strconv.ParseInt(way.Param(ctx, "scheduled_post_id"), 10, 64)
+    err := h.CancelScheduledPost(ctx, scheduledPostID)
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrScheduledPostNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
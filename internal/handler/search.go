@@ -0,0 +1,24 @@
+package handler
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+func (h *handler) searchPosts(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    last, _ := strconv.Atoi(q.Get("last"))
+    before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+    pp, err := h.SearchPosts(r.Context(), q.Get("q"), q.Get("sort"), last, before)
+    if err == service.ErrInvalidSearchQuery || err == service.ErrInvalidSearchSort {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, pp, http.StatusOK)
+}
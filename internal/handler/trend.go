@@ -0,0 +1,25 @@
+package handler
+
+import (
+    "net/http"
+
+    "github.com/secmohammed/go-twitter/internal/service"
+)
+
+func (h *handler) trends(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    t, err := h.Trends(r.Context(), q.Get("window"), q.Get("scope") == "following")
+    if err == service.ErrUnauthenticated {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err == service.ErrInvalidTrendsWindow {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    respond(w, t, http.StatusOK)
+}
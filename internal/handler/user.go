@@ -73,8 +73,8 @@ func (h *handler) followers(w http.ResponseWriter, r *http.Request) {
     username := way.Param(ctx, "username")
     first, _ := strconv.Atoi(q.Get("first"))
     after := q.Get("after")
-    response, err := h.Followers(ctx, username, first, after)
-    if err == service.ErrInvalidUsername {
+    response, err := h.Followers(ctx, username, q.Get("sort"), first, after)
+    if err == service.ErrInvalidUsername || err == service.ErrInvalidFollowsSort {
         http.Error(w, err.Error(), http.StatusUnprocessableEntity)
         return
     }
@@ -108,8 +108,8 @@ func (h *handler) followees(w http.ResponseWriter, r *http.Request) {
     username := way.Param(ctx, "username")
     first, _ := strconv.Atoi(q.Get("first"))
     after := q.Get("after")
-    response, err := h.Followees(ctx, username, first, after)
-    if err == service.ErrInvalidUsername {
+    response, err := h.Followees(ctx, username, q.Get("sort"), first, after)
+    if err == service.ErrInvalidUsername || err == service.ErrInvalidFollowsSort {
         http.Error(w, err.Error(), http.StatusUnprocessableEntity)
         return
     }
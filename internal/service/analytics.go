@@ -0,0 +1,204 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+const (
+    postEngagementsFlushInterval = time.Second * 15
+    postAnalyticsSeriesPeriod    = time.Hour * 24 * 7
+    engagementDayLayout          = "2006-01-02"
+)
+
+const (
+    engagementImpression   = "impression"
+    engagementProfileClick = "profile_click"
+)
+
+var (
+    //ErrForbiddenPostAnalytics is used to indicate that only the author can see the analytics of a post.
+    ErrForbiddenPostAnalytics = errors.New("you can only see the analytics of your own posts")
+)
+
+// postEngagement is a viewer engagement with a post, counted at most once per viewer per day.
+type postEngagement struct {
+    kind   string
+    postID int64
+    userID int64
+    day    string
+}
+
+// PostAnalytics model.
+type PostAnalytics struct {
+    Impressions   int                  `json:"impressions"`
+    Likes         int                  `json:"likes"`
+    Comments      int                  `json:"comments"`
+    ProfileClicks int                  `json:"profile_clicks"`
+    Series        []PostAnalyticsPoint `json:"series"`
+}
+
+// PostAnalyticsPoint is the engagement a post got within an hour.
+type PostAnalyticsPoint struct {
+    Hour          time.Time `json:"hour"`
+    Impressions   int       `json:"impressions"`
+    Likes         int       `json:"likes"`
+    Comments      int       `json:"comments"`
+    ProfileClicks int       `json:"profile_clicks"`
+}
+
+// recordImpressions buffers the impressions of the posts served to the authenticated user.
+// They're written in batches by flushPostEngagements, so serving posts doesn't write to the database.
+func (s *Service) recordImpressions(ctx context.Context, postIDs ...int64) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return
+    }
+    s.recordPostEngagements(engagementImpression, uid, postIDs...)
+}
+
+//RecordProfileClick counts a visit of the authenticated user to the author profile from one of the author posts.
+func (s *Service) RecordProfileClick(ctx context.Context, postID int64) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    s.recordPostEngagements(engagementProfileClick, uid, postID)
+    return nil
+}
+
+func (s *Service) recordPostEngagements(kind string, uid int64, postIDs ...int64) {
+    now := time.Now()
+    day := now.UTC().Format(engagementDayLayout)
+    s.postEngagementsMu.Lock()
+    defer s.postEngagementsMu.Unlock()
+    for _, postID := range postIDs {
+        e := postEngagement{kind: kind, postID: postID, userID: uid, day: day}
+        if _, ok := s.postEngagements[e]; !ok {
+            s.postEngagements[e] = now
+        }
+    }
+}
+
+// flushPostEngagements writes the buffered engagements in the background.
+// Authors engaging with their own posts and the engagements already counted that day are left out.
+func (s *Service) flushPostEngagements(ctx context.Context) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(postEngagementsFlushInterval):
+            s.postEngagementsMu.Lock()
+            ee := s.postEngagements
+            s.postEngagements = map[postEngagement]time.Time{}
+            s.postEngagementsMu.Unlock()
+            if len(ee) == 0 {
+                continue
+            }
+            kinds := make([]string, 0, len(ee))
+            postIDs := make([]int64, 0, len(ee))
+            userIDs := make([]int64, 0, len(ee))
+            days := make([]string, 0, len(ee))
+            createdAts := make([]string, 0, len(ee))
+            for e, createdAt := range ee {
+                kinds = append(kinds, e.kind)
+                postIDs = append(postIDs, e.postID)
+                userIDs = append(userIDs, e.userID)
+                days = append(days, e.day)
+                createdAts = append(createdAts, createdAt.Format(time.RFC3339Nano))
+            }
+            query := `
+                INSERT INTO post_engagements (kind, post_id, user_id, day, created_at)
+                SELECT engagements.kind, engagements.post_id, engagements.user_id, engagements.day, engagements.created_at
+                FROM unnest($1::varchar[], $2::int[], $3::int[], $4::date[], $5::timestamptz[])
+                    AS engagements (kind, post_id, user_id, day, created_at)
+                INNER JOIN posts ON posts.id = engagements.post_id AND posts.user_id != engagements.user_id
+                ON CONFLICT DO NOTHING`
+            _, err := s.db.ExecContext(ctx, query, pq.Array(kinds), pq.Array(postIDs), pq.Array(userIDs), pq.Array(days), pq.Array(createdAts))
+            if err != nil {
+                log.Printf("couldn't insert post engagements: %v\n", err)
+            }
+        }
+    }
+}
+
+//PostAnalytics shows the author how a post is doing, with an hourly series over its first week.
+func (s *Service) PostAnalytics(ctx context.Context, postID int64) (PostAnalytics, error) {
+    var a PostAnalytics
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return a, ErrUnauthenticated
+    }
+    var authorID int64
+    var createdAt time.Time
+    query := "SELECT user_id, likes_count, comments_count, created_at FROM posts WHERE id = $1"
+    err := s.db.QueryRowContext(ctx, query, postID).Scan(&authorID, &a.Likes, &a.Comments, &createdAt)
+    if err == sql.ErrNoRows {
+        return a, ErrPostNotFound
+    }
+    if err != nil {
+        return a, fmt.Errorf("couldn't query select post: %v", err)
+    }
+    if authorID != uid {
+        return a, ErrForbiddenPostAnalytics
+    }
+    query = `
+        SELECT
+            count(*) FILTER (WHERE kind = 'impression'),
+            count(*) FILTER (WHERE kind = 'profile_click')
+        FROM post_engagements WHERE post_id = $1`
+    if err = s.db.QueryRowContext(ctx, query, postID).Scan(&a.Impressions, &a.ProfileClicks); err != nil {
+        return a, fmt.Errorf("couldn't query count post engagements: %v", err)
+    }
+    end := createdAt.Add(postAnalyticsSeriesPeriod)
+    if now := time.Now(); now.Before(end) {
+        end = now
+    }
+    query = `
+        WITH hours AS (
+            SELECT generate_series(date_trunc('hour', $2::timestamptz), date_trunc('hour', $3::timestamptz), INTERVAL '1 hour') AS hour
+        ), engagements AS (
+            SELECT date_trunc('hour', created_at) AS hour
+                , count(*) FILTER (WHERE kind = 'impression') AS impressions
+                , count(*) FILTER (WHERE kind = 'profile_click') AS profile_clicks
+            FROM post_engagements WHERE post_id = $1
+            GROUP BY 1
+        ), likes AS (
+            SELECT date_trunc('hour', created_at) AS hour, count(*) AS likes
+            FROM post_likes WHERE post_id = $1
+            GROUP BY 1
+        ), post_comments AS (
+            SELECT date_trunc('hour', created_at) AS hour, count(*) AS comments
+            FROM comments WHERE post_id = $1
+            GROUP BY 1
+        )
+        SELECT hours.hour, COALESCE(engagements.impressions, 0), COALESCE(likes.likes, 0), COALESCE(post_comments.comments, 0), COALESCE(engagements.profile_clicks, 0)
+        FROM hours
+        LEFT JOIN engagements ON engagements.hour = hours.hour
+        LEFT JOIN likes ON likes.hour = hours.hour
+        LEFT JOIN post_comments ON post_comments.hour = hours.hour
+        ORDER BY hours.hour`
+    rows, err := s.db.QueryContext(ctx, query, postID, createdAt, end)
+    if err != nil {
+        return a, fmt.Errorf("couldn't query select post analytics series: %v", err)
+    }
+    defer rows.Close()
+    a.Series = []PostAnalyticsPoint{}
+    for rows.Next() {
+        var pt PostAnalyticsPoint
+        if err = rows.Scan(&pt.Hour, &pt.Impressions, &pt.Likes, &pt.Comments, &pt.ProfileClicks); err != nil {
+            return a, fmt.Errorf("couldn't scan post analytics point: %v", err)
+        }
+        a.Series = append(a.Series, pt)
+    }
+    if err = rows.Err(); err != nil {
+        return a, fmt.Errorf("couldn't iterate post analytics series rows: %v", err)
+    }
+    return a, nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+    "context"
+    "fmt"
+)
+
+// BookmarkResponse is used to formulate the bookmark response.
+type BookmarkResponse struct {
+    Bookmarked bool `json:"bookmarked"`
+}
+
+//Bookmark privately saves a post for the authenticated user.
+func (s *Service) Bookmark(ctx context.Context, postID int64) (BookmarkResponse, error) {
+    var response BookmarkResponse
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return response, ErrUnauthenticated
+    }
+    visible, err := postVisible(ctx, s.db, postID, uid, false)
+    if err != nil {
+        return response, err
+    }
+    if !visible {
+        return response, ErrPostNotFound
+    }
+    query := "INSERT INTO bookmarks (user_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+    _, err = s.db.ExecContext(ctx, query, uid, postID)
+    if isForeignKeyViolation(err) {
+        return response, ErrPostNotFound
+    }
+    if err != nil {
+        return response, fmt.Errorf("couldn't insert bookmark: %v", err)
+    }
+    response.Bookmarked = true
+    return response, nil
+}
+
+//DeleteBookmark removes a post from the authenticated user bookmarks.
+func (s *Service) DeleteBookmark(ctx context.Context, postID int64) (BookmarkResponse, error) {
+    var response BookmarkResponse
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return response, ErrUnauthenticated
+    }
+    query := "DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2"
+    if _, err := s.db.ExecContext(ctx, query, uid, postID); err != nil {
+        return response, fmt.Errorf("couldn't delete bookmark: %v", err)
+    }
+    return response, nil
+}
+
+//Bookmarks shows the posts bookmarked by the authenticated user, the last bookmarked first with backward pagination.
+//The before cursor is the id of the last post seen.
+func (s *Service) Bookmarks(ctx context.Context, last int, before int64) ([]Post, error) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return nil, ErrUnauthenticated
+    }
+    last = normalizePageSize(last)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
+    query, args, err := buildQuery(`
+        SELECT `+postColumns+`
+        FROM posts
+        INNER JOIN bookmarks AS saved ON saved.post_id = posts.id AND saved.user_id = @uid
+        `+postJoins+`
+        WHERE `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
+        {{if .before}}
+        AND (saved.created_at, saved.post_id) < (
+            SELECT created_at, post_id FROM bookmarks WHERE user_id = @uid AND post_id = @before
+        )
+        {{end}}
+        ORDER BY saved.created_at DESC, saved.post_id DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "auth":      true,
+        "uid":       uid,
+        "last":      last,
+        "before":    before,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build bookmarks query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select bookmarks: %v", err)
+    }
+    defer rows.Close()
+    pp := make([]Post, 0, last)
+    for rows.Next() {
+        p, err := s.scanPost(rows, true)
+        if err != nil {
+            return nil, fmt.Errorf("couldn't scan bookmarked post: %v", err)
+        }
+        pp = append(pp, p)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate bookmarked posts rows: %v", err)
+    }
+    if err = s.hydratePosts(ctx, postPtrs(pp)...); err != nil {
+        return nil, err
+    }
+    prefs.apply(postPtrs(pp)...)
+    return pp, nil
+}
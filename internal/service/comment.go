@@ -20,20 +20,29 @@ type commentClient struct {
 
 // Comment moddel.
 type Comment struct {
-    ID         int64     `json:"id"`
-    UserID     int64     `json:"-"`
-    PostID     int64     `json:"-"`
-    Content    string    `json:"content"`
-    LikesCount int       `json:"likes_count"`
-    CreatedAt  time.Time `json:"created_at"`
-    User       *User     `json:"user,omitempty"`
-    Post       *Post     `json:"post,omitempty"`
-    Mine       bool      `json:"mine"`
-    Liked      bool      `json:"liked"`
+    ID          int64        `json:"id"`
+    UserID      int64        `json:"-"`
+    PostID      int64        `json:"-"`
+    Content     string       `json:"content"`
+    LikesCount  int          `json:"likes_count"`
+    CreatedAt   time.Time    `json:"created_at"`
+    User        *User        `json:"user,omitempty"`
+    Post        *Post        `json:"post,omitempty"`
+    LinkPreview *LinkPreview `json:"link_preview,omitempty"`
+    Entities    []Entity     `json:"entities"`
+    Mine        bool         `json:"mine"`
+    Liked       bool         `json:"liked"`
 }
 
 func (s *Service) Comments(ctx context.Context, postID int64, last int, before int64) ([]Comment, error) {
     uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    visible, err := postVisible(ctx, s.db, postID, uid, false)
+    if err != nil {
+        return nil, err
+    }
+    if !visible {
+        return nil, ErrPostNotFound
+    }
     last = normalizePageSize(last)
     query, args, err := buildQuery(`
         SELECT comments.id, content, likes_count, created_at, username, avatar
@@ -87,6 +96,12 @@ func (s *Service) Comments(ctx context.Context, postID int64, last int, before i
     if err = rows.Err(); err != nil {
         return nil, fmt.Errorf("Couldn't iterate comment rows: %v", err)
     }
+    if err = s.hydrateCommentLinkPreviews(ctx, cc); err != nil {
+        return nil, err
+    }
+    if err = s.hydrateCommentEntities(ctx, cc); err != nil {
+        return nil, err
+    }
     return cc, nil
 }
 func (s *Service) CreateComment(ctx context.Context, postID int64, content string) (Comment, error) {
@@ -104,15 +119,34 @@ func (s *Service) CreateComment(ctx context.Context, postID int64, content strin
         return comment, fmt.Errorf("Couldn't start transaction:%v", err)
     }
     defer tx.Rollback()
-    query := "INSERT INTO comments (post_id, user_id, likes_count, content) VALUES($1, $2, $3, $4) RETURNING id, created_at"
-    err = tx.QueryRowContext(ctx, query, postID, uid, 0, content).Scan(&comment.ID, &comment.CreatedAt)
+    visible, err := postVisible(ctx, tx, postID, uid, false)
+    if err != nil {
+        return comment, err
+    }
+    if !visible {
+        return comment, ErrPostNotFound
+    }
+    entities, err := collectEntities(ctx, tx, content)
+    if err != nil {
+        return comment, err
+    }
+    rawEntities, err := entitiesJSON(entities)
+    if err != nil {
+        return comment, err
+    }
+    query := "INSERT INTO comments (post_id, user_id, likes_count, content, entities) VALUES($1, $2, $3, $4, $5) RETURNING id, created_at"
+    err = tx.QueryRowContext(ctx, query, postID, uid, 0, content, rawEntities).Scan(&comment.ID, &comment.CreatedAt)
     if isForeignKeyViolation(err) {
         return comment, ErrPostNotFound
     }
+    if err != nil {
+        return comment, fmt.Errorf("Couldn't insert comment: %v", err)
+    }
     comment.Mine = true
     comment.PostID = postID
     comment.UserID = uid
     comment.Content = content
+    comment.Entities = entities
     comment.LikesCount = 0
     comment.Liked = false
     var subscriptionExists bool
@@ -136,6 +170,10 @@ func (s *Service) CreateComment(ctx context.Context, postID int64, content strin
     if _, err = tx.ExecContext(ctx, query, postID); err != nil {
         return comment, fmt.Errorf("Couldn't update and increment post comments count: %v", err)
     }
+    query = "UPDATE users SET comments_count = comments_count + 1 where id = $1"
+    if _, err = tx.ExecContext(ctx, query, uid); err != nil {
+        return comment, fmt.Errorf("Couldn't update and increment user comments count: %v", err)
+    }
     if err := tx.Commit(); err != nil {
         return comment, fmt.Errorf("Couldn't commit creating comment:%v", err)
     }
@@ -154,6 +192,7 @@ func (s *Service) commentCreated(c Comment) {
     go s.notifyComment(c)
     go s.notifyCommentMention(c)
     go s.broadcastComment(c)
+    go s.unfurlComment(c)
 }
 func (s *Service) ToggleCommentLike(ctx context.Context, commentID int64) (ToggleLikeResponse, error) {
     var response ToggleLikeResponse
@@ -203,8 +242,15 @@ func (s *Service) ToggleCommentLike(ctx context.Context, commentID int64) (Toggl
     response.Liked = !response.Liked
     return response, nil
 }
-func (s *Service) SubscribeToComments(ctx context.Context, postID int64) chan Comment {
+func (s *Service) SubscribeToComments(ctx context.Context, postID int64) (chan Comment, error) {
     uid, _ := ctx.Value(KeyAuthUserID).(int64)
+    visible, err := postVisible(ctx, s.db, postID, uid, false)
+    if err != nil {
+        return nil, err
+    }
+    if !visible {
+        return nil, ErrPostNotFound
+    }
     cc := make(chan Comment)
     c := &commentClient{comments: cc, postID: postID, userID: &uid}
     s.commentClients.Store(c, struct{}{})
@@ -213,7 +259,7 @@ func (s *Service) SubscribeToComments(ctx context.Context, postID int64) chan Co
         s.commentClients.Delete(c)
         close(cc)
     }()
-    return cc
+    return cc, nil
 }
 func (s *Service) broadcastComment(c Comment) {
     s.commentClients.Range(func(key, _ interface{}) bool {
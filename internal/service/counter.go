@@ -0,0 +1,155 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "time"
+)
+
+const (
+    defaultCountersReconciliationInterval = time.Hour * 6
+    countersReconciliationStartDelay      = time.Minute
+)
+
+// counter is a denormalized column along with the query computing its real value from the source tables.
+type counter struct {
+    table  string
+    column string
+    source string
+}
+
+var counters = []counter{
+    {"users", "followers_count", "SELECT count(*) FROM follows WHERE follows.followee_id = users.id"},
+    {"users", "followees_count", "SELECT count(*) FROM follows WHERE follows.follower_id = users.id"},
+    {"users", "posts_count", "SELECT count(*) FROM posts WHERE posts.user_id = users.id"},
+    {"users", "likes_given_count", "SELECT count(*) FROM post_likes WHERE post_likes.user_id = users.id"},
+    {"users", "comments_count", "SELECT count(*) FROM comments WHERE comments.user_id = users.id"},
+    {"posts", "likes_count", "SELECT count(*) FROM post_likes WHERE post_likes.post_id = posts.id"},
+    {"posts", "comments_count", "SELECT count(*) FROM comments WHERE comments.post_id = posts.id"},
+    {"posts", "reposts_count", "SELECT count(*) FROM reposts WHERE reposts.post_id = posts.id"},
+    {"posts", "quotes_count", "SELECT count(*) FROM posts AS quotes WHERE quotes.quoted_post_id = posts.id"},
+    {"comments", "likes_count", "SELECT count(*) FROM comment_likes WHERE comment_likes.comment_id = comments.id"},
+    {"lists", "members_count", "SELECT count(*) FROM list_members WHERE list_members.list_id = lists.id"},
+    {"poll_options", "votes_count", "SELECT count(*) FROM poll_votes WHERE poll_votes.option_id = poll_options.id"},
+    {"hashtags", "usage_count", "SELECT count(*) FROM post_hashtags WHERE post_hashtags.hashtag_id = hashtags.id"},
+    {"lists", "subscribers_count", "SELECT count(*) FROM list_subscriptions WHERE list_subscriptions.list_id = lists.id"},
+}
+
+func (c counter) String() string {
+    return c.table + "." + c.column
+}
+
+// CounterCorrection is a single drifted counter that got fixed.
+type CounterCorrection struct {
+    Counter string `json:"counter"`
+    ID      int64  `json:"id"`
+    From    int    `json:"from"`
+    To      int    `json:"to"`
+}
+
+// CountersReconciliation is the summary of a counters reconciliation run.
+type CountersReconciliation struct {
+    StartedAt   time.Time           `json:"started_at"`
+    FinishedAt  time.Time           `json:"finished_at"`
+    SampleSize  int                 `json:"sample_size"` // zero means a full scan.
+    Corrections []CounterCorrection `json:"corrections"`
+    Errors      []string            `json:"errors"`
+}
+
+//RepairCounters fully scans and recomputes every denormalized counter from its source table.
+func (s *Service) RepairCounters(ctx context.Context) CountersReconciliation {
+    return s.reconcileCounters(ctx, 0)
+}
+
+//LastCountersReconciliation returns the summary of the last scheduled counters reconciliation to admins.
+func (s *Service) LastCountersReconciliation(ctx context.Context) (*CountersReconciliation, error) {
+    if err := s.authorizeRole(ctx, roleAdmin); err != nil {
+        return nil, err
+    }
+    s.countersReconciliationMu.Lock()
+    defer s.countersReconciliationMu.Unlock()
+    return s.lastCountersReconciliation, nil
+}
+
+// reconcileCounters compares the counters of sampleSize random rows per table, or of all rows when sampleSize is zero,
+// against their source tables and fixes the mismatches.
+func (s *Service) reconcileCounters(ctx context.Context, sampleSize int) CountersReconciliation {
+    r := CountersReconciliation{
+        StartedAt:   time.Now(),
+        SampleSize:  sampleSize,
+        Corrections: []CounterCorrection{},
+        Errors:      []string{},
+    }
+    for _, c := range counters {
+        if err := s.fixCounter(ctx, c, sampleSize, &r); err != nil {
+            log.Printf("couldn't reconcile %s: %v\n", c, err)
+            r.Errors = append(r.Errors, err.Error())
+        }
+    }
+    r.FinishedAt = time.Now()
+    return r
+}
+
+// fixCounter recomputes the counter of each row in the same statement that updates it,
+// so increments committed meanwhile by other transactions aren't overwritten by a stale count.
+func (s *Service) fixCounter(ctx context.Context, c counter, sampleSize int, r *CountersReconciliation) error {
+    query := "SELECT id FROM " + c.table
+    if sampleSize > 0 {
+        query += fmt.Sprintf(" ORDER BY random() LIMIT %d", sampleSize)
+    }
+    rows, err := s.db.QueryContext(ctx, query)
+    if err != nil {
+        return fmt.Errorf("couldn't query select %s rows: %v", c, err)
+    }
+    defer rows.Close()
+    ids := []int64{}
+    for rows.Next() {
+        var id int64
+        if err = rows.Scan(&id); err != nil {
+            return fmt.Errorf("couldn't scan %s row: %v", c, err)
+        }
+        ids = append(ids, id)
+    }
+    if err = rows.Err(); err != nil {
+        return fmt.Errorf("couldn't iterate %s rows: %v", c, err)
+    }
+    query = fmt.Sprintf(`
+        WITH stored AS (SELECT %[2]s FROM %[1]s WHERE id = $1)
+        UPDATE %[1]s SET %[2]s = (%[3]s)
+        WHERE id = $1 AND %[2]s != (%[3]s)
+        RETURNING (SELECT %[2]s FROM stored), %[2]s`, c.table, c.column, c.source)
+    for _, id := range ids {
+        cc := CounterCorrection{Counter: c.String(), ID: id}
+        err = s.db.QueryRowContext(ctx, query, id).Scan(&cc.From, &cc.To)
+        if err == sql.ErrNoRows {
+            continue
+        }
+        if err != nil {
+            return fmt.Errorf("couldn't update drifted %s: %v", c, err)
+        }
+        log.Printf("corrected %s of %d from %d to %d\n", cc.Counter, cc.ID, cc.From, cc.To)
+        r.Corrections = append(r.Corrections, cc)
+    }
+    return nil
+}
+
+// reconcileCountersPeriodically runs a first reconciliation shortly after startup
+// so admins have a status to check, then one every interval.
+func (s *Service) reconcileCountersPeriodically(ctx context.Context, interval time.Duration, sampleSize int) {
+    wait := countersReconciliationStartDelay
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(wait):
+            wait = interval
+            r := s.reconcileCounters(ctx, sampleSize)
+            log.Printf("counters reconciliation corrected %d counters with %d errors\n", len(r.Corrections), len(r.Errors))
+            s.countersReconciliationMu.Lock()
+            s.lastCountersReconciliation = &r
+            s.countersReconciliationMu.Unlock()
+        }
+    }
+}
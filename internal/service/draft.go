@@ -0,0 +1,258 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+const maxDrafts = 100
+
+var (
+    //ErrDraftNotFound denotes a not found draft.
+    ErrDraftNotFound = errors.New("draft not found")
+    //ErrDraftVersionConflict is used to indicate that the draft was changed since the given version.
+    ErrDraftVersionConflict = errors.New("draft was changed by another device")
+    //ErrTooManyDrafts is used to indicate that the user reached the drafts limit.
+    ErrTooManyDrafts = errors.New("too many drafts")
+)
+
+// Draft model, a post being written, synced across the user devices.
+// Version increases with each change and must be given back to update, delete or publish it.
+type Draft struct {
+    ID        int64     `json:"id"`
+    Content   string    `json:"content"`
+    SpoilerOf *string   `json:"spoiler_of"`
+    NSFW      bool      `json:"nsfw"`
+    MediaIDs  []int64   `json:"media_ids"`
+    Version   int       `json:"version"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DraftInput is the content of a draft.
+type DraftInput struct {
+    Content   string
+    SpoilerOf *string
+    NSFW      bool
+    MediaIDs  []int64
+}
+
+//CreateDraft stores a new draft of the authenticated user.
+func (s *Service) CreateDraft(ctx context.Context, in DraftInput) (Draft, error) {
+    var d Draft
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return d, ErrUnauthenticated
+    }
+    in, err := s.validateDraft(ctx, uid, in)
+    if err != nil {
+        return d, err
+    }
+    query := `
+        INSERT INTO drafts (user_id, content, spoiler_of, nsfw, media_ids)
+        SELECT $1, $2, $3, $4, $5
+        WHERE (SELECT count(*) FROM drafts WHERE user_id = $1) < $6
+        RETURNING id, version, created_at, updated_at`
+    err = s.db.QueryRowContext(ctx, query, uid, in.Content, in.SpoilerOf, in.NSFW, pq.Array(in.MediaIDs), maxDrafts).
+        Scan(&d.ID, &d.Version, &d.CreatedAt, &d.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return d, ErrTooManyDrafts
+    }
+    if err != nil {
+        return d, fmt.Errorf("couldn't insert draft: %v", err)
+    }
+    d.Content = in.Content
+    d.SpoilerOf = in.SpoilerOf
+    d.NSFW = in.NSFW
+    d.MediaIDs = in.MediaIDs
+    return d, nil
+}
+
+//Drafts of the authenticated user, the last updated first with backward pagination.
+func (s *Service) Drafts(ctx context.Context, last int, before int64) ([]Draft, error) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return nil, ErrUnauthenticated
+    }
+    last = normalizePageSize(last)
+    query, args, err := buildQuery(`
+        SELECT id, content, spoiler_of, nsfw, media_ids, version, created_at, updated_at
+        FROM drafts
+        WHERE user_id = @uid
+        {{if .before}}
+        AND (updated_at, id) < (SELECT updated_at, id FROM drafts WHERE id = @before)
+        {{end}}
+        ORDER BY updated_at DESC, id DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "uid":    uid,
+        "last":   last,
+        "before": before,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build drafts query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select drafts: %v", err)
+    }
+    defer rows.Close()
+    dd := make([]Draft, 0, last)
+    for rows.Next() {
+        var d Draft
+        if err = rows.Scan(&d.ID, &d.Content, &d.SpoilerOf, &d.NSFW, pq.Array(&d.MediaIDs), &d.Version, &d.CreatedAt, &d.UpdatedAt); err != nil {
+            return nil, fmt.Errorf("couldn't scan draft: %v", err)
+        }
+        dd = append(dd, d)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate drafts rows: %v", err)
+    }
+    return dd, nil
+}
+
+//Draft of the authenticated user.
+func (s *Service) Draft(ctx context.Context, draftID int64) (Draft, error) {
+    var d Draft
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return d, ErrUnauthenticated
+    }
+    query := `
+        SELECT id, content, spoiler_of, nsfw, media_ids, version, created_at, updated_at
+        FROM drafts WHERE id = $1 AND user_id = $2`
+    err := s.db.QueryRowContext(ctx, query, draftID, uid).
+        Scan(&d.ID, &d.Content, &d.SpoilerOf, &d.NSFW, pq.Array(&d.MediaIDs), &d.Version, &d.CreatedAt, &d.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return d, ErrDraftNotFound
+    }
+    if err != nil {
+        return d, fmt.Errorf("couldn't query select draft: %v", err)
+    }
+    return d, nil
+}
+
+//UpdateDraft replaces the content of a draft of the authenticated user.
+//It fails with ErrDraftVersionConflict when the draft was changed since the given version.
+func (s *Service) UpdateDraft(ctx context.Context, draftID int64, version int, in DraftInput) (Draft, error) {
+    var d Draft
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return d, ErrUnauthenticated
+    }
+    in, err := s.validateDraft(ctx, uid, in)
+    if err != nil {
+        return d, err
+    }
+    query := `
+        UPDATE drafts SET content = $1, spoiler_of = $2, nsfw = $3, media_ids = $4, version = version + 1, updated_at = now()
+        WHERE id = $5 AND user_id = $6 AND version = $7
+        RETURNING version, created_at, updated_at`
+    err = s.db.QueryRowContext(ctx, query, in.Content, in.SpoilerOf, in.NSFW, pq.Array(in.MediaIDs), draftID, uid, version).
+        Scan(&d.Version, &d.CreatedAt, &d.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return d, s.draftConflict(ctx, draftID, uid)
+    }
+    if err != nil {
+        return d, fmt.Errorf("couldn't update draft: %v", err)
+    }
+    d.ID = draftID
+    d.Content = in.Content
+    d.SpoilerOf = in.SpoilerOf
+    d.NSFW = in.NSFW
+    d.MediaIDs = in.MediaIDs
+    return d, nil
+}
+
+//DeleteDraft deletes a draft of the authenticated user at the given version.
+func (s *Service) DeleteDraft(ctx context.Context, draftID int64, version int) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    query := "DELETE FROM drafts WHERE id = $1 AND user_id = $2 AND version = $3"
+    result, err := s.db.ExecContext(ctx, query, draftID, uid, version)
+    if err != nil {
+        return fmt.Errorf("couldn't delete draft: %v", err)
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return s.draftConflict(ctx, draftID, uid)
+    }
+    return nil
+}
+
+//PublishDraft creates a post out of a draft of the authenticated user at the given version and deletes the draft.
+func (s *Service) PublishDraft(ctx context.Context, draftID int64, version int) (TimelineItem, error) {
+    var ti TimelineItem
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ti, ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return ti, fmt.Errorf("Couldn't begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+    var in CreatePostInput
+    query := "DELETE FROM drafts WHERE id = $1 AND user_id = $2 AND version = $3 RETURNING content, spoiler_of, nsfw, media_ids"
+    err = tx.QueryRowContext(ctx, query, draftID, uid, version).Scan(&in.Content, &in.SpoilerOf, &in.NSFW, pq.Array(&in.MediaIDs))
+    if err == sql.ErrNoRows {
+        return ti, s.draftConflict(ctx, draftID, uid)
+    }
+    if err != nil {
+        return ti, fmt.Errorf("couldn't delete draft: %v", err)
+    }
+    if in, err = validateCreatePostInput(in); err != nil {
+        return ti, err
+    }
+    if ti, err = insertPost(ctx, tx, uid, in); err != nil {
+        return ti, err
+    }
+    if err = tx.Commit(); err != nil {
+        return ti, fmt.Errorf("Couldn't commit to publish draft: %v", err)
+    }
+    if err = s.hydratePosts(ctx, &ti.Post); err != nil {
+        return ti, err
+    }
+    go s.postCreated(ti.Post)
+    return ti, nil
+}
+
+// draftConflict tells whether a draft that couldn't be changed doesn't exist or is at another version.
+func (s *Service) draftConflict(ctx context.Context, draftID, uid int64) error {
+    var exists bool
+    query := "SELECT EXISTS (SELECT 1 FROM drafts WHERE id = $1 AND user_id = $2)"
+    if err := s.db.QueryRowContext(ctx, query, draftID, uid).Scan(&exists); err != nil {
+        return fmt.Errorf("couldn't query draft existence: %v", err)
+    }
+    if !exists {
+        return ErrDraftNotFound
+    }
+    return ErrDraftVersionConflict
+}
+
+// validateDraft is more lenient than validatePost since a draft is a work in progress and can be empty.
+func (s *Service) validateDraft(ctx context.Context, uid int64, in DraftInput) (DraftInput, error) {
+    in.Content = strings.TrimSpace(in.Content)
+    if len([]rune(in.Content)) > 480 {
+        return in, ErrInvalidContent
+    }
+    if in.SpoilerOf != nil {
+        *in.SpoilerOf = strings.TrimSpace(*in.SpoilerOf)
+        if *in.SpoilerOf == "" || len([]rune(*in.SpoilerOf)) > 64 {
+            return in, ErrInvalidSpoiler
+        }
+    }
+    mediaIDs, err := normalizeMediaIDs(in.MediaIDs)
+    if err != nil {
+        return in, err
+    }
+    in.MediaIDs = mediaIDs
+    return in, s.checkPendingMedia(ctx, uid, in.MediaIDs)
+}
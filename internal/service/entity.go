@@ -0,0 +1,237 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+
+    "github.com/lib/pq"
+)
+
+const (
+    //EntityMention is a mention of an existing user.
+    EntityMention = "mention"
+    //EntityHashtag is a hashtag.
+    EntityHashtag = "hashtag"
+    //EntityURL is an http(s) URL.
+    EntityURL = "url"
+    //EntityCashtag is a ticker symbol as $TWTR.
+    EntityCashtag = "cashtag"
+)
+
+var rxCashtags = regexp.MustCompile(`\B\$([a-zA-Z]{1,6}(?:[._][a-zA-Z]{1,2})?)\b`)
+
+// Entity is a span of a post or comment content clients render specially.
+// Offsets are given both in UTF-16 code units, as JavaScript and mobile clients count,
+// and in runes. Ends are exclusive.
+type Entity struct {
+    Type      string `json:"type"`
+    Text      string `json:"text"`
+    Value     string `json:"value"`
+    Start     int    `json:"start"`
+    End       int    `json:"end"`
+    RuneStart int    `json:"rune_start"`
+    RuneEnd   int    `json:"rune_end"`
+    UserID    *int64 `json:"user_id,omitempty"`
+}
+
+// collectEntities parses the content once so every client renders it the same way.
+// Mentions of users that don't exist are left out, as are the mentions, hashtags and cashtags within URLs.
+func collectEntities(ctx context.Context, tx *sql.Tx, content string) ([]Entity, error) {
+    ee := parseEntities(content)
+    mentions := []string{}
+    for _, e := range ee {
+        if e.Type == EntityMention {
+            mentions = append(mentions, e.Value)
+        }
+    }
+    userIDs := map[string]int64{}
+    if len(mentions) != 0 {
+        query := "SELECT id, username FROM users WHERE username = ANY($1)"
+        rows, err := tx.QueryContext(ctx, query, pq.Array(mentions))
+        if err != nil {
+            return nil, fmt.Errorf("couldn't query select mentioned users: %v", err)
+        }
+        defer rows.Close()
+        for rows.Next() {
+            var id int64
+            var username string
+            if err = rows.Scan(&id, &username); err != nil {
+                return nil, fmt.Errorf("couldn't scan mentioned user: %v", err)
+            }
+            userIDs[username] = id
+        }
+        if err = rows.Err(); err != nil {
+            return nil, fmt.Errorf("couldn't iterate mentioned users rows: %v", err)
+        }
+    }
+    return resolveMentions(ee, userIDs), nil
+}
+
+// parseEntities finds the entities of the content in order, mentions still without their user.
+func parseEntities(content string) []Entity {
+    type span struct {
+        typ        string
+        start, end int
+        value      string
+    }
+    spans := []span{}
+    urls := [][]int{}
+    for _, loc := range rxURL.FindAllStringIndex(content, -1) {
+        u := strings.TrimRight(content[loc[0]:loc[1]], ".,;:!?)]}")
+        loc[1] = loc[0] + len(u)
+        urls = append(urls, loc)
+        spans = append(spans, span{typ: EntityURL, start: loc[0], end: loc[1], value: u})
+    }
+    withinURL := func(start int) bool {
+        for _, loc := range urls {
+            if start >= loc[0] && start < loc[1] {
+                return true
+            }
+        }
+        return false
+    }
+    for _, loc := range rxMentions.FindAllStringSubmatchIndex(content, -1) {
+        if withinURL(loc[0]) {
+            continue
+        }
+        spans = append(spans, span{typ: EntityMention, start: loc[0], end: loc[1], value: content[loc[2]:loc[3]]})
+    }
+    for _, loc := range rxHashtags.FindAllStringSubmatchIndex(content, -1) {
+        tag := normalizeHashtag(content[loc[2]:loc[3]])
+        if withinURL(loc[0]) || len([]rune(tag)) > maxHashtagLength {
+            continue
+        }
+        spans = append(spans, span{typ: EntityHashtag, start: loc[0], end: loc[1], value: tag})
+    }
+    for _, loc := range rxCashtags.FindAllStringSubmatchIndex(content, -1) {
+        if withinURL(loc[0]) {
+            continue
+        }
+        spans = append(spans, span{typ: EntityCashtag, start: loc[0], end: loc[1], value: strings.ToUpper(content[loc[2]:loc[3]])})
+    }
+    sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+    runeOffsets, utf16Offsets := textOffsets(content)
+    ee := make([]Entity, len(spans))
+    for i, sp := range spans {
+        ee[i] = Entity{
+            Type:      sp.typ,
+            Text:      content[sp.start:sp.end],
+            Value:     sp.value,
+            Start:     utf16Offsets[sp.start],
+            End:       utf16Offsets[sp.end],
+            RuneStart: runeOffsets[sp.start],
+            RuneEnd:   runeOffsets[sp.end],
+        }
+    }
+    return ee
+}
+
+// resolveMentions sets the user of the mentions given their username, dropping the mentions of unknown users.
+func resolveMentions(ee []Entity, userIDs map[string]int64) []Entity {
+    out := make([]Entity, 0, len(ee))
+    for _, e := range ee {
+        if e.Type == EntityMention {
+            id, ok := userIDs[e.Value]
+            if !ok {
+                continue
+            }
+            e.UserID = &id
+        }
+        out = append(out, e)
+    }
+    return out
+}
+
+// textOffsets maps every byte offset of s starting a rune, and its end, to the rune and UTF-16 offsets.
+func textOffsets(s string) (runes, utf16 map[int]int) {
+    runes = map[int]int{}
+    utf16 = map[int]int{}
+    var r, u int
+    for i, c := range s {
+        runes[i] = r
+        utf16[i] = u
+        r++
+        u++
+        if c >= 0x10000 {
+            u++
+        }
+    }
+    runes[len(s)] = r
+    utf16[len(s)] = u
+    return runes, utf16
+}
+
+// mentionedUserIDs returns the distinct users of the mention entities.
+// Mentions are taken from the entities so the ones within URLs don't count.
+func mentionedUserIDs(ee []Entity) []int64 {
+    seen := map[int64]struct{}{}
+    ids := []int64{}
+    for _, e := range ee {
+        if e.Type != EntityMention || e.UserID == nil {
+            continue
+        }
+        if _, ok := seen[*e.UserID]; !ok {
+            seen[*e.UserID] = struct{}{}
+            ids = append(ids, *e.UserID)
+        }
+    }
+    return ids
+}
+
+// entitiesJSON is how entities are stored along the content.
+func entitiesJSON(ee []Entity) (string, error) {
+    b, err := json.Marshal(ee)
+    if err != nil {
+        return "", fmt.Errorf("couldn't marshal entities: %v", err)
+    }
+    return string(b), nil
+}
+
+func (s *Service) entities(ctx context.Context, query string, ids []int64) (map[int64][]Entity, error) {
+    out := map[int64][]Entity{}
+    if len(ids) == 0 {
+        return out, nil
+    }
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select entities: %v", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var id int64
+        var b []byte
+        if err = rows.Scan(&id, &b); err != nil {
+            return nil, fmt.Errorf("couldn't scan entities: %v", err)
+        }
+        var ee []Entity
+        if err = json.Unmarshal(b, &ee); err != nil {
+            return nil, fmt.Errorf("couldn't unmarshal entities: %v", err)
+        }
+        out[id] = ee
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate entities rows: %v", err)
+    }
+    return out, nil
+}
+
+func (s *Service) hydrateCommentEntities(ctx context.Context, cc []Comment) error {
+    ids := make([]int64, len(cc))
+    for i, c := range cc {
+        ids[i] = c.ID
+    }
+    ee, err := s.entities(ctx, "SELECT id, entities FROM comments WHERE id = ANY($1)", ids)
+    if err != nil {
+        return err
+    }
+    for i := range cc {
+        cc[i].Entities = ee[cc[i].ID]
+    }
+    return nil
+}
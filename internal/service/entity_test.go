@@ -0,0 +1,124 @@
+package service
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestTextOffsets(t *testing.T) {
+    tests := []struct {
+        name      string
+        s         string
+        offset    int
+        wantRune  int
+        wantUTF16 int
+    }{
+        {name: "ascii", s: "abc", offset: 2, wantRune: 2, wantUTF16: 2},
+        {name: "two bytes rune", s: "éa", offset: 2, wantRune: 1, wantUTF16: 1},
+        {name: "after astral plane emoji", s: "😀a", offset: 4, wantRune: 1, wantUTF16: 2},
+        {name: "end", s: "a😀", offset: 5, wantRune: 2, wantUTF16: 3},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            runes, utf16 := textOffsets(tt.s)
+            if got := runes[tt.offset]; got != tt.wantRune {
+                t.Errorf("rune offset of %d = %d, want %d", tt.offset, got, tt.wantRune)
+            }
+            if got := utf16[tt.offset]; got != tt.wantUTF16 {
+                t.Errorf("UTF-16 offset of %d = %d, want %d", tt.offset, got, tt.wantUTF16)
+            }
+        })
+    }
+}
+
+func TestParseEntities(t *testing.T) {
+    tests := []struct {
+        name    string
+        content string
+        want    []Entity
+    }{
+        {
+            name:    "astral plane emoji before mention",
+            content: "😀 @john",
+            want: []Entity{
+                {Type: EntityMention, Text: "@john", Value: "john", Start: 3, End: 8, RuneStart: 2, RuneEnd: 7},
+            },
+        },
+        {
+            name:    "astral plane emoji before hashtag and cashtag",
+            content: "👍🏽 #Go $twtr",
+            want: []Entity{
+                {Type: EntityHashtag, Text: "#Go", Value: "go", Start: 5, End: 8, RuneStart: 3, RuneEnd: 6},
+                {Type: EntityCashtag, Text: "$twtr", Value: "TWTR", Start: 9, End: 14, RuneStart: 7, RuneEnd: 12},
+            },
+        },
+        {
+            name:    "mention and hashtag within url",
+            content: "see https://example.com/@john#top @jane",
+            want: []Entity{
+                {Type: EntityURL, Text: "https://example.com/@john#top", Value: "https://example.com/@john#top", Start: 4, End: 33, RuneStart: 4, RuneEnd: 33},
+                {Type: EntityMention, Text: "@jane", Value: "jane", Start: 34, End: 39, RuneStart: 34, RuneEnd: 39},
+            },
+        },
+        {
+            name:    "trailing punctuation on url",
+            content: "read https://example.com/a.",
+            want: []Entity{
+                {Type: EntityURL, Text: "https://example.com/a", Value: "https://example.com/a", Start: 5, End: 26, RuneStart: 5, RuneEnd: 26},
+            },
+        },
+        {
+            name:    "url in parentheses",
+            content: "(https://example.com)!",
+            want: []Entity{
+                {Type: EntityURL, Text: "https://example.com", Value: "https://example.com", Start: 1, End: 20, RuneStart: 1, RuneEnd: 20},
+            },
+        },
+        {
+            name:    "no entities",
+            content: "email me at john@example.com",
+            want:    []Entity{},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := parseEntities(tt.content); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("parseEntities() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestResolveMentions(t *testing.T) {
+    johnID := int64(1)
+    tests := []struct {
+        name    string
+        content string
+        userIDs map[string]int64
+        want    []Entity
+    }{
+        {
+            name:    "known user",
+            content: "@john",
+            userIDs: map[string]int64{"john": johnID},
+            want: []Entity{
+                {Type: EntityMention, Text: "@john", Value: "john", Start: 0, End: 5, RuneStart: 0, RuneEnd: 5, UserID: &johnID},
+            },
+        },
+        {
+            name:    "unknown user",
+            content: "@ghost #go",
+            userIDs: map[string]int64{"john": johnID},
+            want: []Entity{
+                {Type: EntityHashtag, Text: "#go", Value: "go", Start: 7, End: 10, RuneStart: 7, RuneEnd: 10},
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := resolveMentions(parseEntities(tt.content), tt.userIDs); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("resolveMentions() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+//MaxFollowImportUsernames is the max amount of usernames a single import can take.
+const MaxFollowImportUsernames = 5000
+
+// followImportLease is for how long an import stays claimed by the instance running it without progress.
+const followImportLease = time.Minute
+
+var (
+    //ErrInvalidFollowImport is used to indicate that the usernames to import are empty or too many.
+    ErrInvalidFollowImport = errors.New("usernames to import must be between 1 and 5000")
+    //ErrFollowImportNotFound denotes a not found follow import.
+    ErrFollowImportNotFound = errors.New("follow import not found")
+)
+
+// FollowExport is a single exported follower or followee.
+type FollowExport struct {
+    Username   string    `json:"username"`
+    FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowImport model, it reports the progress of a background follow import.
+type FollowImport struct {
+    ID              int64      `json:"id"`
+    UserID          int64      `json:"-"`
+    Status          string     `json:"status"`
+    Total           int        `json:"total"`
+    Processed       int        `json:"processed"`
+    Followed        int        `json:"followed"`
+    Skipped         int        `json:"skipped"`
+    FailedUsernames []string   `json:"failed_usernames"`
+    CreatedAt       time.Time  `json:"created_at"`
+    FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+//ExportFollowees of the authenticated user in the order they were followed.
+func (s *Service) ExportFollowees(ctx context.Context) ([]FollowExport, error) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return nil, ErrUnauthenticated
+    }
+    return s.exportFollows(ctx, `
+        SELECT users.username, follows.created_at FROM follows
+        INNER JOIN users ON follows.followee_id = users.id
+        WHERE follows.follower_id = $1
+        ORDER BY follows.created_at ASC`, uid)
+}
+
+//ExportFollowers of the authenticated user in the order they followed.
+func (s *Service) ExportFollowers(ctx context.Context) ([]FollowExport, error) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return nil, ErrUnauthenticated
+    }
+    return s.exportFollows(ctx, `
+        SELECT users.username, follows.created_at FROM follows
+        INNER JOIN users ON follows.follower_id = users.id
+        WHERE follows.followee_id = $1
+        ORDER BY follows.created_at ASC`, uid)
+}
+
+func (s *Service) exportFollows(ctx context.Context, query string, uid int64) ([]FollowExport, error) {
+    rows, err := s.db.QueryContext(ctx, query, uid)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select follows to export: %v", err)
+    }
+    defer rows.Close()
+    ff := []FollowExport{}
+    for rows.Next() {
+        var f FollowExport
+        if err = rows.Scan(&f.Username, &f.FollowedAt); err != nil {
+            return nil, fmt.Errorf("couldn't scan exported follow: %v", err)
+        }
+        ff = append(ff, f)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate exported follow rows: %v", err)
+    }
+    return ff, nil
+}
+
+//ImportFollowees starts a background job following the given usernames on behalf of the authenticated user.
+func (s *Service) ImportFollowees(ctx context.Context, usernames []string) (FollowImport, error) {
+    var fi FollowImport
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return fi, ErrUnauthenticated
+    }
+    seen := map[string]struct{}{}
+    uu := []string{}
+    for _, username := range usernames {
+        username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+        if username == "" {
+            continue
+        }
+        if _, ok := seen[username]; ok {
+            continue
+        }
+        seen[username] = struct{}{}
+        uu = append(uu, username)
+    }
+    if len(uu) == 0 || len(uu) > MaxFollowImportUsernames {
+        return fi, ErrInvalidFollowImport
+    }
+    query := `
+        INSERT INTO follow_imports (user_id, total, usernames, lease_expires_at)
+        VALUES ($1, $2, $3, now() + INTERVAL '1 second' * $4)
+        RETURNING id, status, created_at`
+    if err := s.db.QueryRowContext(ctx, query, uid, len(uu), pq.Array(uu), followImportLease.Seconds()).Scan(&fi.ID, &fi.Status, &fi.CreatedAt); err != nil {
+        return fi, fmt.Errorf("couldn't insert follow import: %v", err)
+    }
+    fi.UserID = uid
+    fi.Total = len(uu)
+    fi.FailedUsernames = []string{}
+    go s.runFollowImport(fi.ID, uid)
+    return fi, nil
+}
+
+//FollowImport is used to report the progress of a follow import of the authenticated user.
+func (s *Service) FollowImport(ctx context.Context, importID int64) (FollowImport, error) {
+    var fi FollowImport
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return fi, ErrUnauthenticated
+    }
+    query := `
+        SELECT id, status, total, processed, followed, skipped, failed_usernames, created_at, finished_at
+        FROM follow_imports WHERE id = $1 AND user_id = $2`
+    err := s.db.QueryRowContext(ctx, query, importID, uid).Scan(
+        &fi.ID,
+        &fi.Status,
+        &fi.Total,
+        &fi.Processed,
+        &fi.Followed,
+        &fi.Skipped,
+        pq.Array(&fi.FailedUsernames),
+        &fi.CreatedAt,
+        &fi.FinishedAt,
+    )
+    if err == sql.ErrNoRows {
+        return fi, ErrFollowImportNotFound
+    }
+    if err != nil {
+        return fi, fmt.Errorf("couldn't query select follow import: %v", err)
+    }
+    fi.UserID = uid
+    return fi, nil
+}
+
+// resumeFollowImports periodically picks up the imports whose lease expired,
+// left behind by an instance that stopped while running them.
+func (s *Service) resumeFollowImports(ctx context.Context) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(followImportLease):
+            query := `
+                UPDATE follow_imports SET lease_expires_at = now() + INTERVAL '1 second' * $1
+                WHERE status IN ('pending', 'running') AND lease_expires_at < now()
+                RETURNING id, user_id`
+            rows, err := s.db.QueryContext(ctx, query, followImportLease.Seconds())
+            if err != nil {
+                log.Printf("couldn't update and claim interrupted follow imports: %v\n", err)
+                continue
+            }
+            for rows.Next() {
+                var importID, userID int64
+                if err = rows.Scan(&importID, &userID); err != nil {
+                    log.Printf("couldn't scan interrupted follow import: %v\n", err)
+                    break
+                }
+                go s.runFollowImport(importID, userID)
+            }
+            if err = rows.Err(); err != nil {
+                log.Printf("couldn't iterate interrupted follow imports rows: %v\n", err)
+            }
+            rows.Close()
+        }
+    }
+}
+
+func (s *Service) runFollowImport(importID, userID int64) {
+    ctx := context.Background()
+    for {
+        done, err := s.importNextFollow(ctx, importID, userID)
+        if err != nil {
+            log.Printf("couldn't import follow: %v\n", err)
+            return
+        }
+        if done {
+            break
+        }
+    }
+    query := "UPDATE follow_imports SET status = 'done', finished_at = now() WHERE id = $1 AND status != 'done'"
+    if _, err := s.db.ExecContext(ctx, query, importID); err != nil {
+        log.Printf("couldn't mark follow import as done: %v\n", err)
+    }
+}
+
+// importNextFollow follows the next username of the import and records the progress in the same transaction,
+// renewing the import lease. The import row stays locked meanwhile, so each username is processed exactly once
+// even when the import gets resumed while still running. It reports whether every username got processed.
+func (s *Service) importNextFollow(ctx context.Context, importID, userID int64) (bool, error) {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return false, fmt.Errorf("couldn't begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    var processed, total int
+    var username sql.NullString
+    query := "SELECT processed, total, usernames[processed + 1] FROM follow_imports WHERE id = $1 FOR UPDATE"
+    if err = tx.QueryRowContext(ctx, query, importID).Scan(&processed, &total, &username); err != nil {
+        return false, fmt.Errorf("couldn't query select follow import progress: %v", err)
+    }
+    if processed >= total {
+        return true, nil
+    }
+    var followedN, skippedN int
+    failed := []string{}
+    followeeID, followed, err := followIfNotFollowing(ctx, tx, userID, username.String)
+    switch {
+    case followed:
+        followedN = 1
+    case err == nil || err == ErrForbiddenFollow:
+        skippedN = 1
+    case err == ErrInvalidUsername || err == ErrUserNotFound:
+        failed = append(failed, username.String)
+    default:
+        return false, fmt.Errorf("couldn't import follow of %q: %v", username.String, err)
+    }
+    query = `
+        UPDATE follow_imports SET
+            status = 'running',
+            processed = processed + 1,
+            followed = followed + $2,
+            skipped = skipped + $3,
+            failed_usernames = failed_usernames || $4::varchar[],
+            lease_expires_at = now() + INTERVAL '1 second' * $5
+        WHERE id = $1`
+    if _, err = tx.ExecContext(ctx, query, importID, followedN, skippedN, pq.Array(failed), followImportLease.Seconds()); err != nil {
+        return false, fmt.Errorf("couldn't update follow import progress: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return false, fmt.Errorf("couldn't commit follow import progress: %v", err)
+    }
+    if followed {
+        go s.notifyFollower(userID, followeeID)
+    }
+    return false, nil
+}
+
+// followIfNotFollowing follows the user within tx with the same counters as ToggleFollow,
+// but never unfollows an already followed user. The caller notifies the followee once committed.
+func followIfNotFollowing(ctx context.Context, tx *sql.Tx, followerID int64, username string) (int64, bool, error) {
+    if !rxUsername.MatchString(username) {
+        return 0, false, ErrInvalidUsername
+    }
+    var followeeID int64
+    query := "SELECT id FROM users where username = $1"
+    err := tx.QueryRowContext(ctx, query, username).Scan(&followeeID)
+    if err == sql.ErrNoRows {
+        return 0, false, ErrUserNotFound
+    }
+    if err != nil {
+        return 0, false, fmt.Errorf("Couldn't query select user id from followee username: %v", err)
+    }
+    if followeeID == followerID {
+        return 0, false, ErrForbiddenFollow
+    }
+    var following bool
+    query = "SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2)"
+    if err = tx.QueryRowContext(ctx, query, followerID, followeeID).Scan(&following); err != nil {
+        return 0, false, fmt.Errorf("Couldn't query select exists due to: %v", err)
+    }
+    if following {
+        return followeeID, false, nil
+    }
+    if _, err = insertFollow(ctx, tx, followerID, followeeID); err != nil {
+        return 0, false, err
+    }
+    return followeeID, true, nil
+}
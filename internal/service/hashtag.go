@@ -0,0 +1,144 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "regexp"
+
+    "github.com/lib/pq"
+)
+
+const maxHashtagLength = 100
+
+var rxHashtag = regexp.MustCompile(`^[\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*$`)
+
+var (
+    //ErrInvalidHashtag is used to indicate that the given hashtag is malformed.
+    ErrInvalidHashtag = errors.New("invalid hashtag")
+    //ErrHashtagNotFound denotes a hashtag never used.
+    ErrHashtagNotFound = errors.New("hashtag not found")
+)
+
+// Hashtag model.
+type Hashtag struct {
+    ID         int64  `json:"-"`
+    Name       string `json:"name"`
+    UsageCount int    `json:"usage_count"`
+}
+
+//Hashtag is used to fetch a hashtag along with its usage count. It matches case-insensitively.
+func (s *Service) Hashtag(ctx context.Context, tag string) (Hashtag, error) {
+    var h Hashtag
+    tag, err := validateHashtag(tag)
+    if err != nil {
+        return h, err
+    }
+    query := "SELECT id, name, usage_count FROM hashtags WHERE name = $1"
+    err = s.db.QueryRowContext(ctx, query, tag).Scan(&h.ID, &h.Name, &h.UsageCount)
+    if err == sql.ErrNoRows {
+        return h, ErrHashtagNotFound
+    }
+    if err != nil {
+        return h, fmt.Errorf("couldn't query select hashtag: %v", err)
+    }
+    return h, nil
+}
+
+//HashtagPosts shows the posts tagged with the hashtag in desc order with backward pagination.
+func (s *Service) HashtagPosts(ctx context.Context, tag string, last int, before int64) ([]Post, error) {
+    tag, err := validateHashtag(tag)
+    if err != nil {
+        return nil, err
+    }
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    last = normalizePageSize(last)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
+    query, args, err := buildQuery(`
+        SELECT `+postColumns+`
+        FROM posts
+        INNER JOIN post_hashtags ON post_hashtags.post_id = posts.id
+        INNER JOIN hashtags ON post_hashtags.hashtag_id = hashtags.id AND hashtags.name = @tag
+        `+postJoins+`
+        WHERE posts.visibility != 'unlisted' AND `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
+        {{if .before}}AND posts.id < @before{{end}}
+        ORDER BY posts.id DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "auth":      auth,
+        "uid":       uid,
+        "tag":       tag,
+        "last":      last,
+        "before":    before,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build hashtag posts query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select hashtag posts: %v", err)
+    }
+    defer rows.Close()
+    pp := make([]Post, 0, last)
+    for rows.Next() {
+        p, err := s.scanPost(rows, auth)
+        if err != nil {
+            return nil, fmt.Errorf("couldn't scan hashtag post: %v", err)
+        }
+        pp = append(pp, p)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate hashtag posts rows: %v", err)
+    }
+    if err = s.hydratePosts(ctx, postPtrs(pp)...); err != nil {
+        return nil, err
+    }
+    prefs.apply(postPtrs(pp)...)
+    return pp, nil
+}
+
+func validateHashtag(tag string) (string, error) {
+    tag = normalizeHashtag(tag)
+    if !rxHashtag.MatchString(tag) || len([]rune(tag)) > maxHashtagLength {
+        return "", ErrInvalidHashtag
+    }
+    return tag, nil
+}
+
+// linkHashtags links the post to the hashtags of its content, creating them when first used.
+func linkHashtags(ctx context.Context, tx *sql.Tx, postID int64, content string) error {
+    tags := collectHashtags(content)
+    if len(tags) == 0 {
+        return nil
+    }
+    query := `
+        WITH tags AS (
+            INSERT INTO hashtags (name, usage_count) SELECT unnest($2::varchar[]), 1
+            ON CONFLICT (name) DO UPDATE SET usage_count = hashtags.usage_count + 1
+            RETURNING id
+        )
+        INSERT INTO post_hashtags (post_id, hashtag_id) SELECT $1, id FROM tags`
+    if _, err := tx.ExecContext(ctx, query, postID, pq.Array(tags)); err != nil {
+        return fmt.Errorf("couldn't insert post hashtags: %v", err)
+    }
+    return nil
+}
+
+// unlinkHashtags removes the hashtags of the post, decrementing their usage count.
+func unlinkHashtags(ctx context.Context, tx *sql.Tx, postID int64) error {
+    query := "UPDATE hashtags SET usage_count = usage_count - 1 WHERE id IN (SELECT hashtag_id FROM post_hashtags WHERE post_id = $1)"
+    if _, err := tx.ExecContext(ctx, query, postID); err != nil {
+        return fmt.Errorf("couldn't update and decrement hashtags usage count: %v", err)
+    }
+    query = "DELETE FROM post_hashtags WHERE post_id = $1"
+    if _, err := tx.ExecContext(ctx, query, postID); err != nil {
+        return fmt.Errorf("couldn't delete post hashtags: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+)
+
+//PostLikes shows the users who liked a post, the last liker first with forward pagination.
+//The after cursor is the username of the last liker seen.
+func (s *Service) PostLikes(ctx context.Context, postID int64, first int, after string) ([]UserProfile, error) {
+    uid, _ := ctx.Value(KeyAuthUserID).(int64)
+    visible, err := postVisible(ctx, s.db, postID, uid, false)
+    if err != nil {
+        return nil, err
+    }
+    if !visible {
+        return nil, ErrPostNotFound
+    }
+    return s.likers(ctx, "post_likes", "post_id", postID, first, after)
+}
+
+//CommentLikes shows the users who liked a comment, the last liker first with forward pagination.
+//The after cursor is the username of the last liker seen.
+func (s *Service) CommentLikes(ctx context.Context, commentID int64, first int, after string) ([]UserProfile, error) {
+    uid, _ := ctx.Value(KeyAuthUserID).(int64)
+    var exists bool
+    query := `SELECT EXISTS (
+        SELECT 1 FROM comments
+        INNER JOIN posts ON comments.post_id = posts.id
+        WHERE comments.id = $1 AND ` + visibleTo("$2") + `
+    )`
+    if err := s.db.QueryRowContext(ctx, query, commentID, uid).Scan(&exists); err != nil {
+        return nil, fmt.Errorf("couldn't query select comment existence: %v", err)
+    }
+    if !exists {
+        return nil, ErrCommentNotFound
+    }
+    return s.likers(ctx, "comment_likes", "comment_id", commentID, first, after)
+}
+
+// likers lists the users in the likes table for the liked id,
+// with the same viewer flags Followers computes.
+func (s *Service) likers(ctx context.Context, table, column string, likedID int64, first int, after string) ([]UserProfile, error) {
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    first = normalizePageSize(first)
+    query, args, err := buildQuery(`
+        SELECT id, email, username, avatar, followers_count, followees_count, posts_count, likes_given_count, comments_count, likes.created_at
+        {{if .auth}}
+        , followers.follower_id IS NOT NULL AS following
+        , followees.followee_id IS NOT NULL AS followeed
+        {{end}}
+        FROM `+table+` AS likes
+        INNER JOIN users ON likes.user_id = users.id
+        {{if .auth}}
+        LEFT JOIN follows AS followers ON followers.follower_id = @uid AND followers.followee_id = users.id
+        LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
+        {{end}}
+        WHERE likes.`+column+` = @liked_id
+        {{if .after}}
+        AND (likes.created_at, username) < (
+            SELECT after_likes.created_at, after_users.username FROM `+table+` AS after_likes
+            INNER JOIN users AS after_users ON after_likes.user_id = after_users.id
+            WHERE after_users.username = @after AND after_likes.`+column+` = @liked_id
+        )
+        {{end}}
+        ORDER BY likes.created_at DESC, username DESC
+        LIMIT @first`, map[string]interface{}{
+        "auth":     auth,
+        "uid":      uid,
+        "liked_id": likedID,
+        "first":    first,
+        "after":    after,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build likers sql query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select likers: %v", err)
+    }
+    defer rows.Close()
+    uu := make([]UserProfile, 0, first)
+    for rows.Next() {
+        var u UserProfile
+        var avatar sql.NullString
+        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount, &u.PostsCount, &u.LikesGivenCount, &u.CommentsCount, &u.LikedAt}
+        if auth {
+            dest = append(dest, &u.Following, &u.Followeed)
+        }
+        if err = rows.Scan(dest...); err != nil {
+            return nil, fmt.Errorf("couldn't scan liker: %v", err)
+        }
+        u.Me = auth && uid == u.ID
+        if !u.Me {
+            u.ID = 0
+            u.Email = ""
+        }
+        if avatar.Valid {
+            avatarURL := s.origin + "/avatars/users/" + avatar.String
+            u.AvatarURL = &avatarURL
+        }
+        uu = append(uu, u)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate likers rows: %v", err)
+    }
+    return uu, nil
+}
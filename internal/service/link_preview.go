@@ -0,0 +1,442 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "html"
+    "io"
+    "io/ioutil"
+    "log"
+    "mime"
+    "net"
+    "net/http"
+    "path"
+    "regexp"
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/disintegration/imaging"
+    "github.com/lib/pq"
+    gonanoid "github.com/matoous/go-nanoid"
+)
+
+const (
+    linkPreviewTimeout       = time.Second * 5
+    linkPreviewFailureTTL    = time.Hour
+    maxLinkPreviewRedirects  = 3
+    maxLinkPreviewURLLength  = 2048
+    maxLinkPreviewPageBytes  = 1 << 20 // 1 MB
+    maxLinkPreviewImageBytes = 5 << 20 // 5 MB
+    maxLinkPreviewPixels     = 25000000
+    linkPreviewImageWidth    = 600
+    linkPreviewImageHeight   = 315
+)
+
+var linkPreviewsDir = path.Join("public", "link_previews")
+
+var (
+    rxURL      = regexp.MustCompile(`https?://[^\s<>"']+`)
+    rxMetaTag  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+    rxTitleTag = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+    rxHTMLAttr = regexp.MustCompile(`(?is)([a-z][a-z0-9:_-]*)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+    // nonPublicIPNets are the unspecified, loopback, private, shared, link local, benchmarking,
+    // multicast and reserved ranges, along with NAT64 which reaches IPv4 through IPv6.
+    nonPublicIPNets = mustParseCIDRs(
+        "0.0.0.0/8",
+        "10.0.0.0/8",
+        "100.64.0.0/10",
+        "127.0.0.0/8",
+        "169.254.0.0/16",
+        "172.16.0.0/12",
+        "192.0.0.0/24",
+        "192.168.0.0/16",
+        "198.18.0.0/15",
+        "224.0.0.0/4",
+        "240.0.0.0/4",
+        "::/128",
+        "::1/128",
+        "64:ff9b::/96",
+        "fc00::/7",
+        "fe80::/10",
+        "ff00::/8",
+    )
+
+    errNotPublicAddress = errors.New("refusing to connect to a non public address")
+)
+
+// LinkPreview is the OpenGraph metadata of the first link of a post or comment.
+type LinkPreview struct {
+    URL         string  `json:"url"`
+    Title       string  `json:"title"`
+    Description string  `json:"description,omitempty"`
+    SiteName    string  `json:"site_name,omitempty"`
+    ImageURL    *string `json:"image_url,omitempty"`
+}
+
+// openGraph is the metadata parsed out of a page.
+type openGraph struct {
+    title       string
+    description string
+    siteName    string
+    image       string
+}
+
+// newLinkPreviewClient creates the http client used for unfurling links.
+// The service passes publicAddressOnly as dial control so it only connects to public addresses,
+// checked after DNS resolution so rebinding can't get around it.
+func newLinkPreviewClient(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *http.Client {
+    dialer := &net.Dialer{Timeout: timeout, Control: control}
+    return &http.Client{
+        Timeout: timeout,
+        Transport: &http.Transport{
+            DialContext:           dialer.DialContext,
+            TLSHandshakeTimeout:   timeout,
+            ResponseHeaderTimeout: timeout,
+            MaxIdleConns:          10,
+            IdleConnTimeout:       time.Minute,
+        },
+        CheckRedirect: func(req *http.Request, via []*http.Request) error {
+            if len(via) >= maxLinkPreviewRedirects {
+                return errors.New("too many redirects")
+            }
+            if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+                return fmt.Errorf("unsupported redirect scheme %q", req.URL.Scheme)
+            }
+            return nil
+        },
+    }
+}
+
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+    if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+        return errNotPublicAddress
+    }
+    return nil
+}
+
+// isPublicIP tells whether the address is out of every non public range,
+// IPv4 mapped IPv6 addresses are checked as IPv4.
+func isPublicIP(ip net.IP) bool {
+    for _, n := range nonPublicIPNets {
+        if n.Contains(ip) {
+            return false
+        }
+    }
+    return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+    nn := make([]*net.IPNet, len(cidrs))
+    for i, cidr := range cidrs {
+        _, n, err := net.ParseCIDR(cidr)
+        if err != nil {
+            panic(err)
+        }
+        nn[i] = n
+    }
+    return nn
+}
+
+// collectURLs returns the distinct http(s) URLs of the given text in order.
+func collectURLs(s string) []string {
+    seen := map[string]struct{}{}
+    uu := []string{}
+    for _, u := range rxURL.FindAllString(s, -1) {
+        u = strings.TrimRight(u, ".,;:!?)]}")
+        if _, ok := seen[u]; ok {
+            continue
+        }
+        seen[u] = struct{}{}
+        uu = append(uu, u)
+    }
+    return uu
+}
+
+// firstLinkPreviewURL is the URL worth unfurling in the given text, if any.
+func firstLinkPreviewURL(s string) *string {
+    for _, u := range collectURLs(s) {
+        if len(u) <= maxLinkPreviewURLLength {
+            return &u
+        }
+    }
+    return nil
+}
+
+func (s *Service) unfurlPost(p Post) {
+    ctx := context.Background()
+    u := firstLinkPreviewURL(p.Content)
+    query := "UPDATE posts SET link_preview_url = $1 WHERE id = $2"
+    if _, err := s.db.ExecContext(ctx, query, u, p.ID); err != nil {
+        log.Printf("couldn't update post link preview url: %v\n", err)
+        return
+    }
+    if u == nil {
+        return
+    }
+    lp := s.linkPreview(ctx, *u)
+    if lp == nil {
+        return
+    }
+    p.LinkPreview = lp
+    s.broadcastPostEvent(p, TimelineItemEventUpdated)
+}
+
+func (s *Service) unfurlComment(c Comment) {
+    ctx := context.Background()
+    u := firstLinkPreviewURL(c.Content)
+    if u == nil {
+        return
+    }
+    query := "UPDATE comments SET link_preview_url = $1 WHERE id = $2"
+    if _, err := s.db.ExecContext(ctx, query, u, c.ID); err != nil {
+        log.Printf("couldn't update comment link preview url: %v\n", err)
+        return
+    }
+    s.linkPreview(ctx, *u)
+}
+
+// linkPreview returns the cached preview of the URL, fetching it when missing.
+// Failed fetches are cached too, and retried after linkPreviewFailureTTL.
+func (s *Service) linkPreview(ctx context.Context, rawURL string) *LinkPreview {
+    lp := LinkPreview{URL: rawURL}
+    var image sql.NullString
+    var ok bool
+    var fetchedAt time.Time
+    query := "SELECT title, description, site_name, image, ok, fetched_at FROM link_previews WHERE url = $1"
+    err := s.db.QueryRowContext(ctx, query, rawURL).Scan(&lp.Title, &lp.Description, &lp.SiteName, &image, &ok, &fetchedAt)
+    if err != nil && err != sql.ErrNoRows {
+        log.Printf("couldn't query select link preview: %v\n", err)
+        return nil
+    }
+    if err == nil && (ok || time.Since(fetchedAt) < linkPreviewFailureTTL) {
+        if !ok {
+            return nil
+        }
+        s.setLinkPreviewImageURL(&lp, image)
+        return &lp
+    }
+
+    og, err := fetchOpenGraph(ctx, s.linkPreviewClient, rawURL)
+    ok = err == nil && og.title != ""
+    if err != nil {
+        log.Printf("couldn't fetch link preview of %q: %v\n", rawURL, err)
+    }
+    image = sql.NullString{}
+    if ok && og.image != "" {
+        filename, err := downloadLinkPreviewImage(ctx, s.linkPreviewClient, og.image)
+        if err != nil {
+            log.Printf("couldn't download link preview image of %q: %v\n", rawURL, err)
+        } else {
+            image = sql.NullString{String: filename, Valid: true}
+        }
+    }
+    query = `
+        INSERT INTO link_previews (url, title, description, site_name, image, ok) VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (url) DO UPDATE SET
+            title = excluded.title,
+            description = excluded.description,
+            site_name = excluded.site_name,
+            image = excluded.image,
+            ok = excluded.ok,
+            fetched_at = now()`
+    if _, err = s.db.ExecContext(ctx, query, rawURL, og.title, og.description, og.siteName, image, ok); err != nil {
+        log.Printf("couldn't upsert link preview: %v\n", err)
+    }
+    if !ok {
+        return nil
+    }
+    lp.Title = og.title
+    lp.Description = og.description
+    lp.SiteName = og.siteName
+    s.setLinkPreviewImageURL(&lp, image)
+    return &lp
+}
+
+func (s *Service) setLinkPreviewImageURL(lp *LinkPreview, image sql.NullString) {
+    if image.Valid {
+        imageURL := s.origin + "/link_previews/" + image.String
+        lp.ImageURL = &imageURL
+    }
+}
+
+// fetchOpenGraph gets the page with the given client and parses its OpenGraph or Twitter card metadata.
+func fetchOpenGraph(ctx context.Context, client *http.Client, rawURL string) (openGraph, error) {
+    var og openGraph
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+    if err != nil {
+        return og, fmt.Errorf("couldn't create page request: %v", err)
+    }
+    req.Header.Set("Accept", "text/html")
+    resp, err := client.Do(req)
+    if err != nil {
+        return og, fmt.Errorf("couldn't get page: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return og, fmt.Errorf("unexpected page status %d", resp.StatusCode)
+    }
+    if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+        return og, fmt.Errorf("unexpected page content type %q", mediaType)
+    }
+    b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxLinkPreviewPageBytes))
+    if err != nil {
+        return og, fmt.Errorf("couldn't read page: %v", err)
+    }
+    og = parseOpenGraph(string(b))
+    if og.image != "" {
+        imageURL, err := resp.Request.URL.Parse(og.image)
+        if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") {
+            og.image = ""
+        } else {
+            og.image = imageURL.String()
+        }
+    }
+    return og, nil
+}
+
+// parseOpenGraph reads the OpenGraph metadata of the page, falling back to Twitter cards and the page title.
+func parseOpenGraph(doc string) openGraph {
+    meta := map[string]string{}
+    for _, tag := range rxMetaTag.FindAllString(doc, -1) {
+        attrs := map[string]string{}
+        for _, m := range rxHTMLAttr.FindAllStringSubmatch(tag, -1) {
+            attrs[strings.ToLower(m[1])] = m[2] + m[3]
+        }
+        key := attrs["property"]
+        if key == "" {
+            key = attrs["name"]
+        }
+        key = strings.ToLower(key)
+        if _, ok := meta[key]; !ok && key != "" {
+            meta[key] = strings.TrimSpace(html.UnescapeString(attrs["content"]))
+        }
+    }
+    first := func(keys ...string) string {
+        for _, k := range keys {
+            if v := meta[k]; v != "" {
+                return v
+            }
+        }
+        return ""
+    }
+    og := openGraph{
+        title:       first("og:title", "twitter:title"),
+        description: first("og:description", "twitter:description", "description"),
+        siteName:    first("og:site_name"),
+        image:       first("og:image", "og:image:url", "twitter:image", "twitter:image:src"),
+    }
+    if og.title == "" {
+        if m := rxTitleTag.FindStringSubmatch(doc); m != nil {
+            og.title = strings.TrimSpace(html.UnescapeString(m[1]))
+        }
+    }
+    return og
+}
+
+// downloadLinkPreviewImage gets the preview image with the given client, resizes it and stores it on disk.
+func downloadLinkPreviewImage(ctx context.Context, client *http.Client, imageURL string) (string, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+    if err != nil {
+        return "", fmt.Errorf("couldn't create image request: %v", err)
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("couldn't get image: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("unexpected image status %d", resp.StatusCode)
+    }
+    img, format, err := decodeImage(io.LimitReader(resp.Body, maxLinkPreviewImageBytes), maxLinkPreviewPixels)
+    if err != nil {
+        return "", fmt.Errorf("couldn't read image: %v", err)
+    }
+    if format != "png" && format != "jpeg" {
+        return "", fmt.Errorf("unsupported image format %q", format)
+    }
+    name, err := gonanoid.Nanoid()
+    if err != nil {
+        return "", fmt.Errorf("couldn't generate image filename: %v", err)
+    }
+    filename := name + ".jpg"
+    if format == "png" {
+        filename = name + ".png"
+    }
+    img = imaging.Fill(img, linkPreviewImageWidth, linkPreviewImageHeight, imaging.Center, imaging.CatmullRom)
+    if err = writeImage(path.Join(linkPreviewsDir, filename), img, format); err != nil {
+        return "", err
+    }
+    return filename, nil
+}
+
+// linkPreviews runs the given query selecting the successfully fetched previews of the given posts or comments,
+// keyed by their ID.
+func (s *Service) linkPreviews(ctx context.Context, query string, ids []int64) (map[int64]*LinkPreview, error) {
+    out := map[int64]*LinkPreview{}
+    if len(ids) == 0 {
+        return out, nil
+    }
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select link previews: %v", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var id int64
+        var lp LinkPreview
+        var image sql.NullString
+        if err = rows.Scan(&id, &lp.URL, &lp.Title, &lp.Description, &lp.SiteName, &image); err != nil {
+            return nil, fmt.Errorf("couldn't scan link preview: %v", err)
+        }
+        s.setLinkPreviewImageURL(&lp, image)
+        out[id] = &lp
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate link previews rows: %v", err)
+    }
+    return out, nil
+}
+
+// hydrateLinkPreviews fills the link preview of the given posts with a single query.
+func (s *Service) hydrateLinkPreviews(ctx context.Context, pp ...*Post) error {
+    ids := make([]int64, len(pp))
+    for i, p := range pp {
+        ids[i] = p.ID
+    }
+    lpp, err := s.linkPreviews(ctx, `
+        SELECT posts.id, link_previews.url, title, description, site_name, image FROM posts
+        INNER JOIN link_previews ON link_previews.url = posts.link_preview_url
+        WHERE posts.id = ANY($1) AND link_previews.ok`, ids)
+    if err != nil {
+        return err
+    }
+    for _, p := range pp {
+        p.LinkPreview = lpp[p.ID]
+    }
+    return nil
+}
+
+func (s *Service) hydrateCommentLinkPreviews(ctx context.Context, cc []Comment) error {
+    ids := make([]int64, len(cc))
+    for i, c := range cc {
+        ids[i] = c.ID
+    }
+    lpp, err := s.linkPreviews(ctx, `
+        SELECT comments.id, link_previews.url, title, description, site_name, image FROM comments
+        INNER JOIN link_previews ON link_previews.url = comments.link_preview_url
+        WHERE comments.id = ANY($1) AND link_previews.ok`, ids)
+    if err != nil {
+        return err
+    }
+    for i := range cc {
+        cc[i].LinkPreview = lpp[cc[i].ID]
+    }
+    return nil
+}
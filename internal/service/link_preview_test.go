@@ -0,0 +1,254 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/binary"
+    "fmt"
+    "hash/crc32"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestParseOpenGraph(t *testing.T) {
+    tests := []struct {
+        name string
+        doc  string
+        want openGraph
+    }{
+        {
+            name: "opengraph",
+            doc: `<html><head>
+                <meta property="og:title" content="Title">
+                <meta property="og:description" content="Description">
+                <meta property="og:site_name" content="Site">
+                <meta property="og:image" content="https://example.com/image.png">
+                <title>Page title</title>
+            </head></html>`,
+            want: openGraph{title: "Title", description: "Description", siteName: "Site", image: "https://example.com/image.png"},
+        },
+        {
+            name: "twitter card fallback",
+            doc: `<meta name="twitter:title" content="Card title">
+                <meta name="twitter:description" content="Card description">
+                <meta name="twitter:image:src" content="https://example.com/card.jpg">`,
+            want: openGraph{title: "Card title", description: "Card description", image: "https://example.com/card.jpg"},
+        },
+        {
+            name: "title tag and description fallback",
+            doc:  `<title> Tom &amp; Jerry </title><meta name="description" content="Cartoon">`,
+            want: openGraph{title: "Tom & Jerry", description: "Cartoon"},
+        },
+        {
+            name: "first tag wins and attributes are case insensitive",
+            doc: `<META PROPERTY='og:title' CONTENT='First'>
+                <meta property="og:title" content="Second">`,
+            want: openGraph{title: "First"},
+        },
+        {
+            name: "no metadata",
+            doc:  `<p>nothing here</p>`,
+            want: openGraph{},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := parseOpenGraph(tt.doc); got != tt.want {
+                t.Errorf("parseOpenGraph() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestIsPublicIP(t *testing.T) {
+    tests := []struct {
+        ip   string
+        want bool
+    }{
+        {"93.184.216.34", true},
+        {"2606:2800:220:1:248:1893:25c8:1946", true},
+        {"127.0.0.1", false},
+        {"::1", false},
+        {"10.0.0.1", false},
+        {"172.16.0.1", false},
+        {"192.168.1.1", false},
+        {"169.254.169.254", false},
+        {"100.64.0.1", false},
+        {"0.0.0.0", false},
+        {"0.1.2.3", false},
+        {"198.18.0.1", false},
+        {"198.19.255.255", false},
+        {"240.0.0.1", false},
+        {"255.255.255.255", false},
+        {"::", false},
+        {"::ffff:127.0.0.1", false},
+        {"64:ff9b::7f00:1", false},
+        {"fd00::1", false},
+        {"fe80::1", false},
+        {"ff02::1", false},
+        {"224.0.0.1", false},
+        {"198.20.0.1", true},
+    }
+    for _, tt := range tests {
+        if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+            t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+        }
+    }
+}
+
+func TestFetchOpenGraph(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        fmt.Fprint(w, `<meta property="og:title" content="Local"><meta property="og:image" content="/image.png">`)
+    }))
+    defer srv.Close()
+
+    og, err := fetchOpenGraph(context.Background(), newLinkPreviewClient(time.Second, nil), srv.URL+"/page")
+    if err != nil {
+        t.Fatalf("fetchOpenGraph() error = %v", err)
+    }
+    if og.title != "Local" {
+        t.Errorf("title = %q, want %q", og.title, "Local")
+    }
+    if want := srv.URL + "/image.png"; og.image != want {
+        t.Errorf("image = %q, want %q", og.image, want)
+    }
+}
+
+func TestFetchOpenGraphRefusesPrivateAddresses(t *testing.T) {
+    var hits int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&hits, 1)
+        w.Header().Set("Content-Type", "text/html")
+        fmt.Fprint(w, `<title>Internal</title>`)
+    }))
+    defer srv.Close()
+
+    _, err := fetchOpenGraph(context.Background(), newLinkPreviewClient(time.Second, publicAddressOnly), srv.URL)
+    if err == nil || !strings.Contains(err.Error(), errNotPublicAddress.Error()) {
+        t.Fatalf("fetchOpenGraph() error = %v, want %v", err, errNotPublicAddress)
+    }
+    if n := atomic.LoadInt32(&hits); n != 0 {
+        t.Errorf("server got %d requests, want none", n)
+    }
+}
+
+func TestFetchOpenGraphBodyLimit(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html")
+        fmt.Fprint(w, `<title>Visible</title>`)
+        fmt.Fprint(w, strings.Repeat(" ", maxLinkPreviewPageBytes))
+        fmt.Fprint(w, `<meta property="og:title" content="Past the limit">`)
+    }))
+    defer srv.Close()
+
+    og, err := fetchOpenGraph(context.Background(), newLinkPreviewClient(time.Second, nil), srv.URL)
+    if err != nil {
+        t.Fatalf("fetchOpenGraph() error = %v", err)
+    }
+    if og.title != "Visible" {
+        t.Errorf("title = %q, want the metadata past %d bytes ignored", og.title, maxLinkPreviewPageBytes)
+    }
+}
+
+func TestFetchOpenGraphTimeout(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        select {
+        case <-r.Context().Done():
+        case <-time.After(time.Second * 2):
+        }
+    }))
+    defer srv.Close()
+
+    start := time.Now()
+    _, err := fetchOpenGraph(context.Background(), newLinkPreviewClient(time.Millisecond*100, nil), srv.URL)
+    if err == nil {
+        t.Fatal("fetchOpenGraph() error = nil, want timeout")
+    }
+    if d := time.Since(start); d > time.Second {
+        t.Errorf("fetchOpenGraph() took %v, want it to give up after the client timeout", d)
+    }
+}
+
+func TestDownloadLinkPreviewImageRefusesTooManyPixels(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write(pngHeader(100000, 100000))
+    }))
+    defer srv.Close()
+
+    _, err := downloadLinkPreviewImage(context.Background(), newLinkPreviewClient(time.Second, nil), srv.URL)
+    if err == nil || !strings.Contains(err.Error(), ErrMediaTooLarge.Error()) {
+        t.Fatalf("downloadLinkPreviewImage() error = %v, want %v", err, ErrMediaTooLarge)
+    }
+}
+
+// pngHeader is the signature and header chunk of a PNG claiming the given dimensions, without any pixel data.
+func pngHeader(width, height uint32) []byte {
+    var b bytes.Buffer
+    b.WriteString("\x89PNG\r\n\x1a\n")
+    chunk := make([]byte, 17)
+    copy(chunk, "IHDR")
+    binary.BigEndian.PutUint32(chunk[4:], width)
+    binary.BigEndian.PutUint32(chunk[8:], height)
+    chunk[12] = 8 // bit depth
+    chunk[13] = 2 // truecolor
+    binary.Write(&b, binary.BigEndian, uint32(13))
+    b.Write(chunk)
+    binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+    return b.Bytes()
+}
+
+// TestLinkPreviewCache needs a database with the schema loaded, given by TEST_DATABASE_URL.
+func TestLinkPreviewCache(t *testing.T) {
+    databaseURL := os.Getenv("TEST_DATABASE_URL")
+    if databaseURL == "" {
+        t.Skip("TEST_DATABASE_URL not set")
+    }
+    db, err := sql.Open("postgres", databaseURL)
+    if err != nil {
+        t.Fatalf("couldn't open db: %v", err)
+    }
+    defer db.Close()
+
+    var hits int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&hits, 1)
+        if r.URL.Path == "/broken" {
+            http.Error(w, "broken", http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "text/html")
+        fmt.Fprint(w, `<meta property="og:title" content="Cached">`)
+    }))
+    defer srv.Close()
+
+    s := &Service{db: db, origin: "http://localhost", linkPreviewClient: newLinkPreviewClient(time.Second, nil)}
+    ctx := context.Background()
+    for _, path := range []string{"/page", "/broken"} {
+        rawURL := srv.URL + path
+        defer db.Exec("DELETE FROM link_previews WHERE url = $1", rawURL)
+        atomic.StoreInt32(&hits, 0)
+
+        first := s.linkPreview(ctx, rawURL)
+        second := s.linkPreview(ctx, rawURL)
+        if n := atomic.LoadInt32(&hits); n != 1 {
+            t.Errorf("%s: fetched %d times, want once", path, n)
+        }
+        if path == "/broken" {
+            if first != nil || second != nil {
+                t.Errorf("%s: got a preview of a failed fetch", path)
+            }
+            continue
+        }
+        if first == nil || second == nil || first.Title != "Cached" || *first != *second {
+            t.Errorf("%s: previews = %+v, %+v, want the same cached preview", path, first, second)
+        }
+    }
+}
@@ -0,0 +1,541 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+)
+
+var (
+    //ErrListNotFound denotes a not found list, or a private list of another user.
+    ErrListNotFound = errors.New("list not found")
+    //ErrInvalidListName is used to indicate that list name is invalid.
+    ErrInvalidListName = errors.New("invalid list name")
+    //ErrForbiddenListAccess is used to indicate that only the list owner can manage it.
+    ErrForbiddenListAccess = errors.New("only the list owner can manage the list")
+    //ErrForbiddenListSubscription is used to indicate that user can't subscribe to his own or to a private list.
+    ErrForbiddenListSubscription = errors.New("you can only subscribe to public lists of other users")
+)
+
+// List model.
+type List struct {
+    ID               int64     `json:"id"`
+    UserID           int64     `json:"-"`
+    Name             string    `json:"name"`
+    Private          bool      `json:"private"`
+    MembersCount     int       `json:"members_count"`
+    SubscribersCount int       `json:"subscribers_count"`
+    CreatedAt        time.Time `json:"created_at"`
+    User             *User     `json:"user,omitempty"`
+    Mine             bool      `json:"mine"`
+    Subscribed       bool      `json:"subscribed"`
+}
+
+//CreateList creates a named list owned by the authenticated user.
+func (s *Service) CreateList(ctx context.Context, name string, private bool) (List, error) {
+    var l List
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return l, ErrUnauthenticated
+    }
+    name = strings.TrimSpace(name)
+    if name == "" || len([]rune(name)) > 64 {
+        return l, ErrInvalidListName
+    }
+    query := "INSERT INTO lists (user_id, name, private) VALUES ($1, $2, $3) RETURNING id, created_at"
+    if err := s.db.QueryRowContext(ctx, query, uid, name, private).Scan(&l.ID, &l.CreatedAt); err != nil {
+        return l, fmt.Errorf("couldn't insert list: %v", err)
+    }
+    l.UserID = uid
+    l.Name = name
+    l.Private = private
+    l.Mine = true
+    return l, nil
+}
+
+//List is used to fetch a list by its id. Private lists are only visible to their owner.
+func (s *Service) List(ctx context.Context, listID int64) (List, error) {
+    var l List
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    query, args, err := buildQuery(`
+        SELECT lists.id, lists.user_id, name, private, members_count, subscribers_count, lists.created_at
+        , users.username, users.avatar
+        {{if .auth}}
+        , subscriptions.user_id IS NOT NULL AS subscribed
+        {{end}}
+        FROM lists
+        INNER JOIN users ON lists.user_id = users.id
+        {{if .auth}}
+        LEFT JOIN list_subscriptions AS subscriptions
+            ON subscriptions.user_id = @uid AND subscriptions.list_id = lists.id
+        {{end}}
+        WHERE lists.id = @list_id
+    `, map[string]interface{}{
+        "auth":    auth,
+        "uid":     uid,
+        "list_id": listID,
+    })
+    if err != nil {
+        return l, fmt.Errorf("couldn't build find list query: %v", err)
+    }
+    var u User
+    var avatar sql.NullString
+    dest := []interface{}{&l.ID, &l.UserID, &l.Name, &l.Private, &l.MembersCount, &l.SubscribersCount, &l.CreatedAt, &u.Username, &avatar}
+    if auth {
+        dest = append(dest, &l.Subscribed)
+    }
+    err = s.db.QueryRowContext(ctx, query, args...).Scan(dest...)
+    if err == sql.ErrNoRows {
+        return l, ErrListNotFound
+    }
+    if err != nil {
+        return l, fmt.Errorf("couldn't query select list: %v", err)
+    }
+    l.Mine = auth && l.UserID == uid
+    if l.Private && !l.Mine {
+        return List{}, ErrListNotFound
+    }
+    if avatar.Valid {
+        avatarURL := s.origin + "/avatars/users/" + avatar.String
+        u.AvatarURL = &avatarURL
+    }
+    l.User = &u
+    return l, nil
+}
+
+// Lists owned or subscribed by a user in desc order with backward pagination.
+func (s *Service) Lists(ctx context.Context, username string, last int, before int64) ([]List, error) {
+    username = strings.TrimSpace(username)
+    if !rxUsername.MatchString(username) {
+        return nil, ErrInvalidUsername
+    }
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    last = normalizePageSize(last)
+    query, args, err := buildQuery(`
+        SELECT lists.id, lists.user_id, name, private, members_count, subscribers_count, lists.created_at
+        , users.username, users.avatar
+        {{if .auth}}
+        , subscriptions.user_id IS NOT NULL AS subscribed
+        {{end}}
+        FROM lists
+        INNER JOIN users ON lists.user_id = users.id
+        {{if .auth}}
+        LEFT JOIN list_subscriptions AS subscriptions
+            ON subscriptions.user_id = @uid AND subscriptions.list_id = lists.id
+        {{end}}
+        WHERE (
+            lists.user_id = (SELECT id FROM users WHERE username = @username)
+            OR lists.id IN (
+                SELECT list_id FROM list_subscriptions
+                WHERE user_id = (SELECT id FROM users WHERE username = @username)
+            )
+        )
+        AND (lists.private = false {{if .auth}}OR lists.user_id = @uid{{end}})
+        {{if .before}}AND lists.id < @before{{end}}
+        ORDER BY lists.id DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "auth":     auth,
+        "uid":      uid,
+        "username": username,
+        "last":     last,
+        "before":   before,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build lists query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select lists: %v", err)
+    }
+    defer rows.Close()
+    ll := make([]List, 0, last)
+    for rows.Next() {
+        var l List
+        var u User
+        var avatar sql.NullString
+        dest := []interface{}{&l.ID, &l.UserID, &l.Name, &l.Private, &l.MembersCount, &l.SubscribersCount, &l.CreatedAt, &u.Username, &avatar}
+        if auth {
+            dest = append(dest, &l.Subscribed)
+        }
+        if err = rows.Scan(dest...); err != nil {
+            return nil, fmt.Errorf("couldn't scan list: %v", err)
+        }
+        l.Mine = auth && l.UserID == uid
+        if avatar.Valid {
+            avatarURL := s.origin + "/avatars/users/" + avatar.String
+            u.AvatarURL = &avatarURL
+        }
+        l.User = &u
+        ll = append(ll, l)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate list rows: %v", err)
+    }
+    return ll, nil
+}
+
+//DeleteList deletes a list of the authenticated user along with its members and subscriptions.
+func (s *Service) DeleteList(ctx context.Context, listID int64) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("couldn't begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    if err = listOwnedBy(ctx, tx, listID, uid); err != nil {
+        return err
+    }
+    query := "DELETE FROM list_members WHERE list_id = $1"
+    if _, err = tx.ExecContext(ctx, query, listID); err != nil {
+        return fmt.Errorf("couldn't delete list members: %v", err)
+    }
+    query = "DELETE FROM list_subscriptions WHERE list_id = $1"
+    if _, err = tx.ExecContext(ctx, query, listID); err != nil {
+        return fmt.Errorf("couldn't delete list subscriptions: %v", err)
+    }
+    query = "DELETE FROM lists WHERE id = $1"
+    if _, err = tx.ExecContext(ctx, query, listID); err != nil {
+        return fmt.Errorf("couldn't delete list: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("couldn't commit to delete list: %v", err)
+    }
+    return nil
+}
+
+//AddListMember adds a user to a list of the authenticated user.
+func (s *Service) AddListMember(ctx context.Context, listID int64, username string) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    username = strings.TrimSpace(username)
+    if !rxUsername.MatchString(username) {
+        return ErrInvalidUsername
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("couldn't begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    if err = listOwnedBy(ctx, tx, listID, uid); err != nil {
+        return err
+    }
+    var memberID int64
+    query := "SELECT id FROM users WHERE username = $1"
+    err = tx.QueryRowContext(ctx, query, username).Scan(&memberID)
+    if err == sql.ErrNoRows {
+        return ErrUserNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("couldn't query select list member id: %v", err)
+    }
+    query = "INSERT INTO list_members (list_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+    result, err := tx.ExecContext(ctx, query, listID, memberID)
+    if err != nil {
+        return fmt.Errorf("couldn't insert list member: %v", err)
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return nil
+    }
+    query = "UPDATE lists SET members_count = members_count + 1 WHERE id = $1"
+    if _, err = tx.ExecContext(ctx, query, listID); err != nil {
+        return fmt.Errorf("couldn't update and increment list members count: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("couldn't commit to add list member: %v", err)
+    }
+    return nil
+}
+
+//RemoveListMember removes a user from a list of the authenticated user.
+func (s *Service) RemoveListMember(ctx context.Context, listID int64, username string) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    username = strings.TrimSpace(username)
+    if !rxUsername.MatchString(username) {
+        return ErrInvalidUsername
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("couldn't begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    if err = listOwnedBy(ctx, tx, listID, uid); err != nil {
+        return err
+    }
+    query := `
+        DELETE FROM list_members
+        WHERE list_id = $1 AND user_id = (SELECT id FROM users WHERE username = $2)
+    `
+    result, err := tx.ExecContext(ctx, query, listID, username)
+    if err != nil {
+        return fmt.Errorf("couldn't delete list member: %v", err)
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return nil
+    }
+    query = "UPDATE lists SET members_count = members_count - 1 WHERE id = $1"
+    if _, err = tx.ExecContext(ctx, query, listID); err != nil {
+        return fmt.Errorf("couldn't update and decrement list members count: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("couldn't commit to remove list member: %v", err)
+    }
+    return nil
+}
+
+//ListMembers in asc order with forward pagination.
+func (s *Service) ListMembers(ctx context.Context, listID int64, first int, after string) ([]UserProfile, error) {
+    if _, err := s.List(ctx, listID); err != nil {
+        return nil, err
+    }
+    after = strings.TrimSpace(after)
+    first = normalizePageSize(first)
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    query, args, err := buildQuery(`
+        SELECT id, email, username, avatar, followers_count, followees_count, posts_count, likes_given_count, comments_count
+        {{if .auth}}
+        , followers.follower_id IS NOT NULL AS following
+        , followees.followee_id IS NOT NULL AS followeed
+        {{end}}
+        FROM list_members
+        INNER JOIN users ON list_members.user_id = users.id
+        {{if .auth}}
+        LEFT JOIN follows AS followers ON followers.follower_id = @uid AND followers.followee_id = users.id
+        LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
+        {{end}}
+        WHERE list_members.list_id = @list_id
+        {{if .after}}AND username > @after{{end}}
+        ORDER BY username ASC
+        LIMIT @first`, map[string]interface{}{
+        "auth":    auth,
+        "uid":     uid,
+        "list_id": listID,
+        "first":   first,
+        "after":   after,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build list members sql query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select list members: %v", err)
+    }
+    defer rows.Close()
+    uu := make([]UserProfile, 0, first)
+    for rows.Next() {
+        var u UserProfile
+        var avatar sql.NullString
+        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount, &u.PostsCount, &u.LikesGivenCount, &u.CommentsCount}
+        if auth {
+            dest = append(dest, &u.Following, &u.Followeed)
+        }
+        if err = rows.Scan(dest...); err != nil {
+            return nil, fmt.Errorf("couldn't scan list member: %v", err)
+        }
+        u.Me = auth && uid == u.ID
+        if !u.Me {
+            u.ID = 0
+            u.Email = ""
+        }
+        if avatar.Valid {
+            avatarURL := s.origin + "/avatars/users/" + avatar.String
+            u.AvatarURL = &avatarURL
+        }
+        uu = append(uu, u)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate list member rows: %v", err)
+    }
+    return uu, nil
+}
+
+// ToggleListSubscription so you can follow a public list of another user.
+func (s *Service) ToggleListSubscription(ctx context.Context, listID int64) (ToggleSubscriptionOutput, error) {
+    var out ToggleSubscriptionOutput
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return out, ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return out, fmt.Errorf("could not begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    var ownerID int64
+    var private bool
+    query := "SELECT user_id, private FROM lists WHERE id = $1"
+    err = tx.QueryRowContext(ctx, query, listID).Scan(&ownerID, &private)
+    if err == sql.ErrNoRows || (err == nil && private && ownerID != uid) {
+        return out, ErrListNotFound
+    }
+    if err != nil {
+        return out, fmt.Errorf("could not query select list: %v", err)
+    }
+    if private || ownerID == uid {
+        return out, ErrForbiddenListSubscription
+    }
+    query = `SELECT EXISTS (
+        SELECT 1 FROM list_subscriptions WHERE user_id = $1 AND list_id = $2
+    )`
+    if err = tx.QueryRowContext(ctx, query, uid, listID).Scan(&out.Subscribed); err != nil {
+        return out, fmt.Errorf("could not query select list subscription existence: %v", err)
+    }
+    if out.Subscribed {
+        query = "DELETE FROM list_subscriptions WHERE user_id = $1 AND list_id = $2"
+        if _, err = tx.ExecContext(ctx, query, uid, listID); err != nil {
+            return out, fmt.Errorf("could not delete list subscription: %v", err)
+        }
+        query = "UPDATE lists SET subscribers_count = subscribers_count - 1 WHERE id = $1"
+        if _, err = tx.ExecContext(ctx, query, listID); err != nil {
+            return out, fmt.Errorf("could not update and decrement list subscribers count: %v", err)
+        }
+    } else {
+        query = "INSERT INTO list_subscriptions (user_id, list_id) VALUES ($1, $2)"
+        if _, err = tx.ExecContext(ctx, query, uid, listID); err != nil {
+            return out, fmt.Errorf("could not insert list subscription: %v", err)
+        }
+        query = "UPDATE lists SET subscribers_count = subscribers_count + 1 WHERE id = $1"
+        if _, err = tx.ExecContext(ctx, query, listID); err != nil {
+            return out, fmt.Errorf("could not update and increment list subscribers count: %v", err)
+        }
+    }
+    if err = tx.Commit(); err != nil {
+        return out, fmt.Errorf("could not commit to toggle list subscription: %v", err)
+    }
+    out.Subscribed = !out.Subscribed
+    return out, nil
+}
+
+//ListTimeline shows the posts of the list members in desc order with backward pagination.
+func (s *Service) ListTimeline(ctx context.Context, listID int64, last int, before int64) ([]Post, error) {
+    if _, err := s.List(ctx, listID); err != nil {
+        return nil, err
+    }
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    last = normalizePageSize(last)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
+    query, args, err := buildQuery(`
+        SELECT `+postColumns+`
+        FROM posts
+        INNER JOIN list_members ON list_members.user_id = posts.user_id AND list_members.list_id = @list_id
+        `+postJoins+`
+        WHERE `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
+        {{if .before}}AND posts.id < @before{{end}}
+        ORDER BY posts.created_at DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "auth":      auth,
+        "uid":       uid,
+        "list_id":   listID,
+        "last":      last,
+        "before":    before,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build list timeline query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select list timeline: %v", err)
+    }
+    defer rows.Close()
+    pp := make([]Post, 0, last)
+    for rows.Next() {
+        p, err := s.scanPost(rows, auth)
+        if err != nil {
+            return nil, fmt.Errorf("couldn't scan list timeline post: %v", err)
+        }
+        pp = append(pp, p)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate list timeline rows: %v", err)
+    }
+    if err = s.hydratePosts(ctx, postPtrs(pp)...); err != nil {
+        return nil, err
+    }
+    prefs.apply(postPtrs(pp)...)
+    return pp, nil
+}
+
+//SubscribeToListTimeline streams the new posts of the list members.
+func (s *Service) SubscribeToListTimeline(ctx context.Context, listID int64) (chan TimelineItem, error) {
+    if _, err := s.List(ctx, listID); err != nil {
+        return nil, err
+    }
+    uid, _ := ctx.Value(KeyAuthUserID).(int64)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
+    tt := make(chan TimelineItem)
+    c := &timelineItemClient{timeline: tt, userID: uid, listID: listID, prefs: prefs}
+    s.timelineItemClients.Store(c, struct{}{})
+    go func() {
+        <-ctx.Done()
+        s.timelineItemClients.Delete(c)
+        close(tt)
+    }()
+    return tt, nil
+}
+
+// fanoutListPost streams the post to the timelines of the lists its author is member of.
+// Only posts open to everyone are streamed, as the list viewers may be out of the audience of the others.
+func (s *Service) fanoutListPost(p Post, event string) {
+    if p.Visibility != VisibilityPublic && p.Visibility != VisibilityUnlisted {
+        return
+    }
+    rows, err := s.db.Query("SELECT list_id FROM list_members WHERE user_id = $1", p.UserID)
+    if err != nil {
+        log.Printf("couldn't query select post author lists: %v", err)
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var ti TimelineItem
+        if err = rows.Scan(&ti.ListID); err != nil {
+            log.Printf("couldn't scan post author list: %v", err)
+            return
+        }
+        ti.PostID = p.ID
+        ti.Post = p
+        ti.Event = event
+        go s.broadcastTimelineItem(ti)
+    }
+    if err = rows.Err(); err != nil {
+        log.Printf("couldn't iterate over post author lists: %v", err)
+        return
+    }
+}
+
+func listOwnedBy(ctx context.Context, tx *sql.Tx, listID, uid int64) error {
+    var ownerID int64
+    var private bool
+    query := "SELECT user_id, private FROM lists WHERE id = $1"
+    err := tx.QueryRowContext(ctx, query, listID).Scan(&ownerID, &private)
+    if err == sql.ErrNoRows || (err == nil && private && ownerID != uid) {
+        return ErrListNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("couldn't query select list owner: %v", err)
+    }
+    if ownerID != uid {
+        return ErrForbiddenListAccess
+    }
+    return nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "image"
+    "image/jpeg"
+    "image/png"
+    "io"
+    "log"
+    "os"
+    "path"
+    "strings"
+    "time"
+
+    "github.com/disintegration/imaging"
+    "github.com/lib/pq"
+    gonanoid "github.com/matoous/go-nanoid"
+)
+
+const (
+    //MaxMediaBytes to read per uploaded image.
+    MaxMediaBytes = 10 << 20 // 10 MB
+    //MaxPostMedia is the max amount of media attachments a post can have.
+    MaxPostMedia = 4
+
+    maxMediaAltTextLength = 1000
+    maxMediaSize          = 2048
+    maxMediaPixels        = 40000000
+    mediaThumbnailSize    = 400
+    unattachedMediaTTL    = time.Hour * 24
+)
+
+var mediaDir = path.Join("public", "media")
+
+var (
+    //ErrUnsupportedMediaFormat is used to indicate that the uploaded media has invalid format.
+    ErrUnsupportedMediaFormat = errors.New("only png and jpeg are allowed as media format")
+    //ErrInvalidMediaAltText is used to indicate that the media alt text is too long.
+    ErrInvalidMediaAltText = errors.New("invalid media alt text")
+    //ErrTooManyMedia is used to indicate that a post has more than MaxPostMedia attachments.
+    ErrTooManyMedia = errors.New("a post can have up to 4 media attachments")
+    //ErrMediaTooLarge is used to indicate that the uploaded image has too many pixels to decode.
+    ErrMediaTooLarge = errors.New("media dimensions too large")
+    //ErrMediaNotFound is used to indicate that an attached media doesn't exist, isn't yours or is already attached.
+    ErrMediaNotFound = errors.New("media not found")
+)
+
+// Media model, an image attachment of a post.
+type Media struct {
+    ID           int64  `json:"id"`
+    UserID       int64  `json:"-"`
+    PostID       *int64 `json:"-"`
+    URL          string `json:"url"`
+    ThumbnailURL string `json:"thumbnail_url"`
+    Width        int    `json:"width"`
+    Height       int    `json:"height"`
+    AltText      string `json:"alt_text"`
+}
+
+//UploadMedia stores an image for the authenticated user so it can be attached to a post later.
+func (s *Service) UploadMedia(ctx context.Context, r io.Reader, altText string) (Media, error) {
+    var m Media
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return m, ErrUnauthenticated
+    }
+    altText = strings.TrimSpace(altText)
+    if len([]rune(altText)) > maxMediaAltTextLength {
+        return m, ErrInvalidMediaAltText
+    }
+    img, format, err := decodeImage(io.LimitReader(r, MaxMediaBytes), maxMediaPixels)
+    if err == ErrMediaTooLarge {
+        return m, err
+    }
+    if err != nil {
+        return m, fmt.Errorf("couldn't read media: %v", err)
+    }
+    if format != "png" && format != "jpeg" {
+        return m, ErrUnsupportedMediaFormat
+    }
+    name, err := gonanoid.Nanoid()
+    if err != nil {
+        return m, fmt.Errorf("couldn't generate media filename: %v", err)
+    }
+    ext := ".jpg"
+    if format == "png" {
+        ext = ".png"
+    }
+    filename := name + ext
+    thumbnail := name + "_thumb" + ext
+
+    img = imaging.Fit(img, maxMediaSize, maxMediaSize, imaging.CatmullRom)
+    if err = writeImage(path.Join(mediaDir, filename), img, format); err != nil {
+        return m, err
+    }
+    thumb := imaging.Fill(img, mediaThumbnailSize, mediaThumbnailSize, imaging.Center, imaging.CatmullRom)
+    if err = writeImage(path.Join(mediaDir, thumbnail), thumb, format); err != nil {
+        os.Remove(path.Join(mediaDir, filename))
+        return m, err
+    }
+    bounds := img.Bounds()
+    m.Width = bounds.Dx()
+    m.Height = bounds.Dy()
+    query := `
+        INSERT INTO media (user_id, filename, thumbnail, width, height, alt_text)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id`
+    if err = s.db.QueryRowContext(ctx, query, uid, filename, thumbnail, m.Width, m.Height, altText).Scan(&m.ID); err != nil {
+        os.Remove(path.Join(mediaDir, filename))
+        os.Remove(path.Join(mediaDir, thumbnail))
+        return m, fmt.Errorf("couldn't insert media: %v", err)
+    }
+    m.UserID = uid
+    m.URL = s.mediaURL(filename)
+    m.ThumbnailURL = s.mediaURL(thumbnail)
+    m.AltText = altText
+    return m, nil
+}
+
+// decodeImage reads the image header first so images whose dimensions exceed maxPixels
+// are refused before allocating the decoded image.
+func decodeImage(r io.Reader, maxPixels int) (image.Image, string, error) {
+    var header bytes.Buffer
+    cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+    if err != nil {
+        return nil, "", err
+    }
+    if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+        return nil, "", ErrMediaTooLarge
+    }
+    return image.Decode(io.MultiReader(&header, r))
+}
+
+func writeImage(name string, img image.Image, format string) error {
+    f, err := os.Create(name)
+    if err != nil {
+        return fmt.Errorf("couldn't create image: %v", err)
+    }
+    defer f.Close()
+    if format == "png" {
+        err = png.Encode(f, img)
+    } else {
+        err = jpeg.Encode(f, img, nil)
+    }
+    if err != nil {
+        return fmt.Errorf("couldn't write image to disk: %v", err)
+    }
+    return nil
+}
+
+func (s *Service) mediaURL(filename string) string {
+    return s.origin + "/media/" + filename
+}
+
+// attachMedia attaches the unattached media of the user to the post in the given order.
+func attachMedia(ctx context.Context, tx *sql.Tx, postID, uid int64, mediaIDs []int64) error {
+    if len(mediaIDs) == 0 {
+        return nil
+    }
+    query := `
+        UPDATE media SET post_id = $1, position = array_position($3::int[], id)
+        WHERE id = ANY($3) AND user_id = $2 AND post_id IS NULL`
+    result, err := tx.ExecContext(ctx, query, postID, uid, pq.Array(mediaIDs))
+    if err != nil {
+        return fmt.Errorf("couldn't update and attach media: %v", err)
+    }
+    if n, _ := result.RowsAffected(); int(n) != len(mediaIDs) {
+        return ErrMediaNotFound
+    }
+    return nil
+}
+
+// normalizeMediaIDs drops duplicated media IDs keeping the order.
+func normalizeMediaIDs(mediaIDs []int64) ([]int64, error) {
+    seen := map[int64]struct{}{}
+    ids := []int64{}
+    for _, id := range mediaIDs {
+        if _, ok := seen[id]; ok {
+            continue
+        }
+        seen[id] = struct{}{}
+        ids = append(ids, id)
+    }
+    if len(ids) > MaxPostMedia {
+        return nil, ErrTooManyMedia
+    }
+    return ids, nil
+}
+
+// checkPendingMedia makes sure the media are uploads of the user not attached to any post yet.
+func (s *Service) checkPendingMedia(ctx context.Context, uid int64, mediaIDs []int64) error {
+    if len(mediaIDs) == 0 {
+        return nil
+    }
+    var n int
+    query := "SELECT count(*) FROM media WHERE id = ANY($1) AND user_id = $2 AND post_id IS NULL"
+    if err := s.db.QueryRowContext(ctx, query, pq.Array(mediaIDs), uid).Scan(&n); err != nil {
+        return fmt.Errorf("couldn't query count pending media: %v", err)
+    }
+    if n != len(mediaIDs) {
+        return ErrMediaNotFound
+    }
+    return nil
+}
+
+// hydrateMedia fills the media attachments of the given posts with a single query.
+func (s *Service) hydrateMedia(ctx context.Context, pp ...*Post) error {
+    if len(pp) == 0 {
+        return nil
+    }
+    ids := make([]int64, len(pp))
+    for i, p := range pp {
+        ids[i] = p.ID
+    }
+    query := `
+        SELECT id, post_id, filename, thumbnail, width, height, alt_text FROM media
+        WHERE post_id = ANY($1)
+        ORDER BY position ASC`
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+    if err != nil {
+        return fmt.Errorf("couldn't query select posts media: %v", err)
+    }
+    defer rows.Close()
+    media := map[int64][]Media{}
+    for rows.Next() {
+        var m Media
+        var postID int64
+        var filename, thumbnail string
+        if err = rows.Scan(&m.ID, &postID, &filename, &thumbnail, &m.Width, &m.Height, &m.AltText); err != nil {
+            return fmt.Errorf("couldn't scan post media: %v", err)
+        }
+        m.PostID = &postID
+        m.URL = s.mediaURL(filename)
+        m.ThumbnailURL = s.mediaURL(thumbnail)
+        media[postID] = append(media[postID], m)
+    }
+    if err = rows.Err(); err != nil {
+        return fmt.Errorf("couldn't iterate posts media rows: %v", err)
+    }
+    for _, p := range pp {
+        p.Media = media[p.ID]
+    }
+    return nil
+}
+
+// deleteUnattachedMedia garbage-collects the uploads never attached to a post,
+// or left behind by deleted posts, along with their files.
+// Uploads waiting on a scheduled post or a draft are kept.
+func (s *Service) deleteUnattachedMedia(ctx context.Context) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(time.Hour):
+            query := fmt.Sprintf(`
+                DELETE FROM media WHERE post_id IS NULL AND created_at < now() - INTERVAL '%dm'
+                AND NOT EXISTS (
+                    SELECT 1 FROM scheduled_posts
+                    WHERE scheduled_posts.status = 'scheduled' AND media.id = ANY(scheduled_posts.media_ids)
+                )
+                AND NOT EXISTS (SELECT 1 FROM drafts WHERE media.id = ANY(drafts.media_ids))
+                RETURNING filename, thumbnail`, int(unattachedMediaTTL.Minutes()))
+            rows, err := s.db.QueryContext(ctx, query)
+            if err != nil {
+                log.Printf("couldn't delete unattached media: %v\n", err)
+                continue
+            }
+            for rows.Next() {
+                var filename, thumbnail string
+                if err = rows.Scan(&filename, &thumbnail); err != nil {
+                    log.Printf("couldn't scan deleted media: %v\n", err)
+                    break
+                }
+                os.Remove(path.Join(mediaDir, filename))
+                os.Remove(path.Join(mediaDir, thumbnail))
+            }
+            if err = rows.Err(); err != nil {
+                log.Printf("couldn't iterate deleted media rows: %v\n", err)
+            }
+            rows.Close()
+        }
+    }
+}
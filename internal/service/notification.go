@@ -17,7 +17,7 @@ type Notification struct {
     Actors   []string  `json:"actors"`
     Type     string    `json:"type"`
     Read     bool      `json:"read"`
-    PostID   *int64    `json:"post_id, omitempty"`
+    PostID   *int64    `json:"post_id,omitempty"`
     IssuedAt time.Time `json:"issued_at"`
 }
 type notificationClient struct {
@@ -154,10 +154,11 @@ func (s *Service) notifyComment(c Comment) {
 
     rows, err := s.db.Query(`
         INSERT INTO notifications (user_id, actors, type, post_id)
-        SELECT user_id, $1, 'comment', $2 FROM post_subscriptions
+        SELECT DISTINCT user_id, $1::varchar[], 'comment', $2::int FROM post_subscriptions
         WHERE post_subscriptions.user_id != $3
-            AND post_subscriptions.post_id = $2
-        ON CONFLICT (user_id, type, post_id, read) DO UPDATE SET
+            AND post_subscriptions.post_id IN (`+conversationPostsQuery+`)
+            AND EXISTS (SELECT 1 FROM posts WHERE posts.id = $2 AND `+visibleTo("post_subscriptions.user_id")+`)
+        ON CONFLICT (user_id, type, post_id) WHERE NOT read DO UPDATE SET
             actors = array_prepend($4, array_remove(notifications.actors, $4)),
             issued_at = now()
         RETURNING id, user_id, actors, issued_at`,
@@ -186,16 +187,65 @@ func (s *Service) notifyComment(c Comment) {
         return
     }
 }
-func (s *Service) notifyPostMention(p Post) {
-    mentions := collectMentions(p.Content)
+
+// conversationPostsQuery selects the ids of every post in the conversation of the post $2,
+// so subscriptions to any of them apply to the whole conversation.
+const conversationPostsQuery = `
+    SELECT posts.id FROM posts, (SELECT COALESCE(conversation_id, id) AS id FROM posts WHERE id = $2) AS conversation
+    WHERE posts.id = conversation.id OR posts.conversation_id = conversation.id`
+
+// notifyReply notifies the conversation subscribers within the reply audience about a new reply.
+func (s *Service) notifyReply(p Post) {
+    actor := p.User.Username
+    rows, err := s.db.Query(`
+        INSERT INTO notifications (user_id, actors, type, post_id)
+        SELECT DISTINCT user_id, $1::varchar[], 'reply', $2::int FROM post_subscriptions
+        WHERE post_subscriptions.user_id != $3
+            AND post_subscriptions.post_id IN (`+conversationPostsQuery+`)
+            AND EXISTS (SELECT 1 FROM posts WHERE posts.id = $5 AND `+visibleTo("post_subscriptions.user_id")+`)
+        ON CONFLICT (user_id, type, post_id) WHERE NOT read DO UPDATE SET
+            actors = array_prepend($4, array_remove(notifications.actors, $4)),
+            issued_at = now()
+        RETURNING id, user_id, actors, issued_at`,
+        pq.Array([]string{actor}),
+        *p.InReplyToPostID,
+        p.UserID,
+        actor,
+        p.ID,
+    )
+    if err != nil {
+        log.Printf("couldn't insert reply notification: %v\n", err)
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var n Notification
+        if err = rows.Scan(&n.ID, &n.UserID, pq.Array(&n.Actors), &n.IssuedAt); err != nil {
+            log.Printf("couldn't scan reply notification: %v\n", err)
+            return
+        }
+        n.Type = "reply"
+        n.PostID = p.InReplyToPostID
+        go s.broadcastNotification(n)
+    }
+    if err = rows.Err(); err != nil {
+        log.Printf("couldn't iterate over reply notification rows: %v\n", err)
+        return
+    }
+}
+
+// notifyPostMention notifies the mentioned users within the post audience.
+func (s *Service) notifyPostMention(p Post, mentions []int64) {
     if len(mentions) == 0 {
         return
     }
     actors := []string{p.User.Username}
     rows, err := s.db.Query(`
         INSERT INTO notifications (user_id, actors, type, post_id)
-        SELECT users.id, $1, 'post_mention', $2 FROM users
-        WHERE users.id != $3 AND username = ANY($4)
+        SELECT users.id, $1, 'post_mention', posts.id FROM users, posts
+        WHERE posts.id = $2 AND users.id != $3 AND users.id = ANY($4)
+            AND `+visibleTo("users.id")+`
+        ON CONFLICT (user_id, type, post_id) WHERE NOT read DO UPDATE SET issued_at = now()
         RETURNING id, user_id, issued_at`,
         pq.Array(actors),
         p.ID,
@@ -250,19 +300,20 @@ func (s *Service) broadcastNotification(n Notification) {
     })
 }
 func (s *Service) notifyCommentMention(c Comment) {
-    mentions := collectMentions(c.Content)
+    mentions := mentionedUserIDs(c.Entities)
     if len(mentions) == 0 {
         return
     }
     actor := c.User.Username
     rows, err := s.db.Query(`
         INSERT INTO notifications (user_id, actors, type, post_id)
-        SELECT users.id, $1, 'comment_mention', $2 FROM users
-        WHERE users.id != $3 AND username = ANY($4)
-        ON CONFLICT (user_id, type, post_id, read) DO UPDATE SET
+        SELECT users.id, $1, 'comment_mention', posts.id FROM users, posts
+        WHERE posts.id = $2 AND users.id != $3 AND users.id = ANY($4)
+            AND `+visibleTo("users.id")+`
+        ON CONFLICT (user_id, type, post_id) WHERE NOT read DO UPDATE SET
             actors = array_prepend($5, array_remove(notifications.actors, $5)),
             issued_at = now()
-        RETURNING id, user_id, issued_at`,
+        RETURNING id, user_id, actors, issued_at`,
         pq.Array([]string{actor}),
         c.PostID,
         c.UserID,
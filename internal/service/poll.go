@@ -0,0 +1,296 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+const (
+    minPollOptions         = 2
+    maxPollOptions         = 4
+    maxPollOptionLength    = 25
+    minPollDurationMinutes = 5
+    maxPollDurationMinutes = 60 * 24 * 7
+    pollsInterval          = time.Minute
+)
+
+var (
+    //ErrInvalidPoll is used to indicate that the poll options or duration are out of bounds.
+    ErrInvalidPoll = errors.New("poll must have 2 to 4 distinct options and last between 5 minutes and 7 days")
+    //ErrPollNotFound denotes a post without a poll.
+    ErrPollNotFound = errors.New("poll not found")
+    //ErrPollOptionNotFound denotes a not found poll option.
+    ErrPollOptionNotFound = errors.New("poll option not found")
+    //ErrPollClosed is used to indicate that the poll doesn't take votes anymore.
+    ErrPollClosed = errors.New("poll closed")
+    //ErrAlreadyVoted is used to indicate that the user already voted on the poll.
+    ErrAlreadyVoted = errors.New("already voted")
+)
+
+// PollInput request.
+type PollInput struct {
+    Options         []string `json:"options"`
+    DurationMinutes int      `json:"duration_minutes"`
+}
+
+// Poll model. Votes counts are left out until the viewer votes or the poll closes.
+type Poll struct {
+    EndsAt        time.Time    `json:"ends_at"`
+    Closed        bool         `json:"closed"`
+    Options       []PollOption `json:"options"`
+    VotesCount    *int         `json:"votes_count,omitempty"`
+    VotedOptionID *int64       `json:"voted_option_id"`
+}
+
+// PollOption model.
+type PollOption struct {
+    ID         int64  `json:"id"`
+    Text       string `json:"text"`
+    VotesCount *int   `json:"votes_count,omitempty"`
+}
+
+func validatePoll(in *PollInput) error {
+    if in == nil {
+        return nil
+    }
+    if len(in.Options) < minPollOptions || len(in.Options) > maxPollOptions ||
+        in.DurationMinutes < minPollDurationMinutes || in.DurationMinutes > maxPollDurationMinutes {
+        return ErrInvalidPoll
+    }
+    seen := map[string]struct{}{}
+    for i, option := range in.Options {
+        option = strings.TrimSpace(option)
+        if option == "" || len([]rune(option)) > maxPollOptionLength {
+            return ErrInvalidPoll
+        }
+        if _, ok := seen[strings.ToLower(option)]; ok {
+            return ErrInvalidPoll
+        }
+        seen[strings.ToLower(option)] = struct{}{}
+        in.Options[i] = option
+    }
+    return nil
+}
+
+// insertPoll attaches an already validated poll to the post.
+func insertPoll(ctx context.Context, tx *sql.Tx, postID int64, in *PollInput) error {
+    if in == nil {
+        return nil
+    }
+    query := "INSERT INTO polls (post_id, ends_at) VALUES ($1, now() + INTERVAL '1 minute' * $2)"
+    if _, err := tx.ExecContext(ctx, query, postID, in.DurationMinutes); err != nil {
+        return fmt.Errorf("couldn't insert poll: %v", err)
+    }
+    query = `
+        INSERT INTO poll_options (post_id, position, text)
+        SELECT $1, options.position, options.text FROM unnest($2::varchar[]) WITH ORDINALITY AS options (text, position)`
+    if _, err := tx.ExecContext(ctx, query, postID, pq.Array(in.Options)); err != nil {
+        return fmt.Errorf("couldn't insert poll options: %v", err)
+    }
+    return nil
+}
+
+// hydratePolls fills the polls of the given posts along with the authenticated user vote with a single query.
+func (s *Service) hydratePolls(ctx context.Context, pp ...*Post) error {
+    if len(pp) == 0 {
+        return nil
+    }
+    uid, _ := ctx.Value(KeyAuthUserID).(int64)
+    ids := make([]int64, len(pp))
+    for i, p := range pp {
+        ids[i] = p.ID
+    }
+    query := `
+        SELECT polls.post_id, polls.ends_at, polls.ends_at <= now()
+            , poll_options.id, poll_options.text, poll_options.votes_count
+            , poll_votes.option_id
+        FROM polls
+        INNER JOIN poll_options ON poll_options.post_id = polls.post_id
+        LEFT JOIN poll_votes ON poll_votes.post_id = polls.post_id AND poll_votes.user_id = $2
+        WHERE polls.post_id = ANY($1)
+        ORDER BY poll_options.position`
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), uid)
+    if err != nil {
+        return fmt.Errorf("couldn't query select polls: %v", err)
+    }
+    defer rows.Close()
+    polls := map[int64]*Poll{}
+    for rows.Next() {
+        var postID int64
+        var endsAt time.Time
+        var closed bool
+        var o PollOption
+        var votesCount int
+        var votedOptionID *int64
+        if err = rows.Scan(&postID, &endsAt, &closed, &o.ID, &o.Text, &votesCount, &votedOptionID); err != nil {
+            return fmt.Errorf("couldn't scan poll option: %v", err)
+        }
+        poll, ok := polls[postID]
+        if !ok {
+            poll = &Poll{EndsAt: endsAt, Closed: closed, VotedOptionID: votedOptionID, VotesCount: new(int)}
+            polls[postID] = poll
+        }
+        o.VotesCount = &votesCount
+        *poll.VotesCount += votesCount
+        poll.Options = append(poll.Options, o)
+    }
+    if err = rows.Err(); err != nil {
+        return fmt.Errorf("couldn't iterate polls rows: %v", err)
+    }
+    for _, poll := range polls {
+        if poll.Closed || poll.VotedOptionID != nil {
+            continue
+        }
+        poll.VotesCount = nil
+        for i := range poll.Options {
+            poll.Options[i].VotesCount = nil
+        }
+    }
+    for _, p := range pp {
+        p.Poll = polls[p.ID]
+    }
+    return nil
+}
+
+//VotePoll votes on an option of the post poll as the authenticated user, only once, and returns the poll results.
+func (s *Service) VotePoll(ctx context.Context, postID, optionID int64) (Poll, error) {
+    var poll Poll
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return poll, ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return poll, fmt.Errorf("could not begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    visible, err := postVisible(ctx, tx, postID, uid, false)
+    if err != nil {
+        return poll, err
+    }
+    if !visible {
+        return poll, ErrPostNotFound
+    }
+    var closed bool
+    query := "SELECT ends_at <= now() FROM polls WHERE post_id = $1 FOR SHARE"
+    err = tx.QueryRowContext(ctx, query, postID).Scan(&closed)
+    if err == sql.ErrNoRows {
+        return poll, ErrPollNotFound
+    }
+    if err != nil {
+        return poll, fmt.Errorf("couldn't query select poll: %v", err)
+    }
+    if closed {
+        return poll, ErrPollClosed
+    }
+    query = "UPDATE poll_options SET votes_count = votes_count + 1 WHERE id = $1 AND post_id = $2"
+    result, err := tx.ExecContext(ctx, query, optionID, postID)
+    if err != nil {
+        return poll, fmt.Errorf("couldn't update and increment poll option votes count: %v", err)
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return poll, ErrPollOptionNotFound
+    }
+    query = "INSERT INTO poll_votes (post_id, user_id, option_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING"
+    if result, err = tx.ExecContext(ctx, query, postID, uid, optionID); err != nil {
+        return poll, fmt.Errorf("couldn't insert poll vote: %v", err)
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return poll, ErrAlreadyVoted
+    }
+    if err = tx.Commit(); err != nil {
+        return poll, fmt.Errorf("couldn't commit poll vote: %v", err)
+    }
+    p := Post{ID: postID}
+    if err = s.hydratePolls(ctx, &p); err != nil {
+        return poll, err
+    }
+    if p.Poll == nil {
+        return poll, ErrPollNotFound
+    }
+    return *p.Poll, nil
+}
+
+// endPolls marks the polls past their end as ended in the background, notifying each one exactly once.
+func (s *Service) endPolls(ctx context.Context) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(pollsInterval):
+            rows, err := s.db.QueryContext(ctx, "UPDATE polls SET ended = true WHERE NOT ended AND ends_at <= now() RETURNING post_id")
+            if err != nil {
+                log.Printf("couldn't update and end polls: %v\n", err)
+                continue
+            }
+            postIDs := []int64{}
+            for rows.Next() {
+                var postID int64
+                if err = rows.Scan(&postID); err != nil {
+                    log.Printf("couldn't scan ended poll: %v\n", err)
+                    break
+                }
+                postIDs = append(postIDs, postID)
+            }
+            if err = rows.Err(); err != nil {
+                log.Printf("couldn't iterate ended polls rows: %v\n", err)
+            }
+            rows.Close()
+            for _, postID := range postIDs {
+                s.notifyPollEnded(postID)
+            }
+        }
+    }
+}
+
+// notifyPollEnded notifies the poll author and voters that the poll results are final.
+func (s *Service) notifyPollEnded(postID int64) {
+    var authorID int64
+    var author string
+    query := "SELECT users.id, users.username FROM posts INNER JOIN users ON posts.user_id = users.id WHERE posts.id = $1"
+    if err := s.db.QueryRow(query, postID).Scan(&authorID, &author); err != nil {
+        log.Printf("couldn't query select poll author: %v\n", err)
+        return
+    }
+    actors := []string{author}
+    rows, err := s.db.Query(`
+        INSERT INTO notifications (user_id, actors, type, post_id)
+        SELECT user_id, $1, 'poll_ended', $2 FROM (
+            SELECT $3::int AS user_id
+            UNION
+            SELECT user_id FROM poll_votes WHERE post_id = $2
+        ) AS recipients
+        ON CONFLICT (user_id, type, post_id) WHERE NOT read DO NOTHING
+        RETURNING id, user_id, issued_at`,
+        pq.Array(actors),
+        postID,
+        authorID,
+    )
+    if err != nil {
+        log.Printf("couldn't insert poll ended notification: %v\n", err)
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var n Notification
+        if err = rows.Scan(&n.ID, &n.UserID, &n.IssuedAt); err != nil {
+            log.Printf("couldn't scan poll ended notification: %v\n", err)
+            return
+        }
+        n.Actors = actors
+        n.Type = "poll_ended"
+        n.PostID = &postID
+        go s.broadcastNotification(n)
+    }
+    if err = rows.Err(); err != nil {
+        log.Printf("couldn't iterate over poll ended notification rows: %v\n", err)
+        return
+    }
+}
@@ -3,6 +3,7 @@ package service
 import (
     "context"
     "database/sql"
+    "encoding/json"
     "errors"
     "fmt"
     "log"
@@ -10,6 +11,8 @@ import (
     "time"
 )
 
+const defaultPostEditWindow = time.Minute * 30
+
 var (
     // ErrInvalidContent is used to indicate that content is invalid.
     ErrInvalidContent = errors.New("invalid content")
@@ -17,6 +20,18 @@ var (
     ErrInvalidSpoiler = errors.New("invalid spoiler")
     //ErrPostNotFound denotes a not found post.
     ErrPostNotFound = errors.New("post not found")
+    //ErrQuotedPostNotFound is used to indicate that the post to quote wasn't found.
+    ErrQuotedPostNotFound = errors.New("quoted post not found")
+    //ErrRepliedPostNotFound is used to indicate that the post to reply to wasn't found.
+    ErrRepliedPostNotFound = errors.New("replied post not found")
+    //ErrForbiddenPin is used to indicate that user can only pin his own posts.
+    ErrForbiddenPin = errors.New("you can only pin your own posts")
+    //ErrForbiddenPostEdit is used to indicate that user can only edit his own posts.
+    ErrForbiddenPostEdit = errors.New("you can only edit your own posts")
+    //ErrForbiddenPostDelete is used to indicate that only the author or a moderator can delete a post.
+    ErrForbiddenPostDelete = errors.New("you can only delete your own posts")
+    //ErrPostEditWindowExpired is used to indicate that the post is too old to be edited.
+    ErrPostEditWindowExpired = errors.New("post edit window expired")
 )
 
 // ToggleSubscriptionOutput response.
@@ -24,21 +39,70 @@ type ToggleSubscriptionOutput struct {
     Subscribed bool `json:"subscribed"`
 }
 
+// TogglePinOutput response.
+type TogglePinOutput struct {
+    Pinned bool `json:"pinned"`
+}
+
 // Post model.
 type Post struct {
-    ID            int64     `json:"id"`
-    UserID        int64     `json:"-"`
-    Content       string    `json:"content"`
-    SpoilerOf     *string   `json:"spoiler_of"` // it could be null, so it's a pointer.
-    NSFW          bool      `json:"nsfw"`
-    LikesCount    int       `json:"likes_count"`
-    CreatedAt     time.Time `json:"created_at"`
-    User          *User     `json:"user,omitempty"`
-    Comments      []Comment `json:"comments,omitempty"`
-    CommentsCount int       `json:"comments_count"`
-    Mine          bool      `json:"mine"`
-    Liked         bool      `json:"liked"`
-    Subscribed    bool      `json:"subscribed"`
+    ID              int64        `json:"id"`
+    UserID          int64        `json:"-"`
+    Content         string       `json:"content"`
+    SpoilerOf       *string      `json:"spoiler_of"` // it could be null, so it's a pointer.
+    NSFW            bool         `json:"nsfw"`
+    LikesCount      int          `json:"likes_count"`
+    CreatedAt       time.Time    `json:"created_at"`
+    EditedAt        *time.Time   `json:"edited_at"`
+    User            *User        `json:"user,omitempty"`
+    Comments        []Comment    `json:"comments,omitempty"`
+    CommentsCount   int          `json:"comments_count"`
+    RepostsCount    int          `json:"reposts_count"`
+    QuotesCount     int          `json:"quotes_count"`
+    QuotedPostID    *int64       `json:"-"`
+    Quote           *QuotedPost  `json:"quote,omitempty"`
+    Media           []Media      `json:"media,omitempty"`
+    LinkPreview     *LinkPreview `json:"link_preview,omitempty"`
+    Poll            *Poll        `json:"poll,omitempty"`
+    InReplyToPostID *int64       `json:"in_reply_to_post_id"`
+    ConversationID  int64        `json:"conversation_id"`
+    Entities        []Entity     `json:"entities"`
+    Visibility      string       `json:"visibility"`
+    Mine            bool         `json:"mine"`
+    Liked           bool         `json:"liked"`
+    Subscribed      bool         `json:"subscribed"`
+    Bookmarked      bool         `json:"bookmarked"`
+    Blur            bool         `json:"blur"`
+    ExpandSpoiler   bool         `json:"expand_spoiler"`
+    Pinned          bool         `json:"pinned"`
+}
+
+// PostEdit is a previous version of an edited post.
+type PostEdit struct {
+    ID        int64     `json:"id"`
+    Content   string    `json:"content"`
+    SpoilerOf *string   `json:"spoiler_of"`
+    NSFW      bool      `json:"nsfw"`
+    EditedAt  time.Time `json:"edited_at"` // when this version got replaced.
+}
+
+// CreatePostInput request.
+type CreatePostInput struct {
+    Content         string
+    SpoilerOf       *string
+    NSFW            bool
+    QuotedPostID    *int64
+    InReplyToPostID *int64
+    MediaIDs        []int64
+    Poll            *PollInput
+    Visibility      string
+}
+
+// UpdatePostInput request. Nil fields are left as they are, an empty spoiler removes it.
+type UpdatePostInput struct {
+    Content   *string
+    SpoilerOf *string
+    NSFW      *bool
 }
 
 //ToggleLikeResponse is used to formulate the like response.
@@ -47,27 +111,108 @@ type ToggleLikeResponse struct {
     LikesCount int  `json:"likes_count"`
 }
 
-//Post is used to fetch a post by its id.
-func (s *Service) Post(ctx context.Context, postID int64) (Post, error) {
+// postColumns selects a post along with its author and, when authenticated, the viewer flags.
+// It goes along postJoins and the rows are read with scanPost.
+const postColumns = `
+    posts.id, posts.user_id, posts.content, posts.spoiler_of, posts.nsfw, posts.likes_count, posts.created_at, posts.edited_at
+    , posts.comments_count, posts.reposts_count, posts.quotes_count, posts.quoted_post_id, posts.in_reply_to_post_id
+    , COALESCE(posts.conversation_id, posts.id), posts.visibility, posts.entities
+    , users.username, users.avatar
+    {{if .auth}}
+    , posts.user_id = @uid AS mine
+    , likes.user_id IS NOT NULL AS liked
+    , subscriptions.user_id IS NOT NULL AS subscribed
+    , bookmarks.user_id IS NOT NULL AS bookmarked
+    {{end}}`
+
+// postJoins joins the posts with their author and, when authenticated, with the viewer likes, subscriptions and bookmarks.
+const postJoins = `
+    INNER JOIN users ON posts.user_id = users.id
+    {{if .auth}}
+    LEFT JOIN post_likes AS likes
+        ON likes.user_id = @uid AND likes.post_id = posts.id
+    LEFT JOIN post_subscriptions AS subscriptions
+        ON subscriptions.user_id = @uid AND subscriptions.post_id = posts.id
+    LEFT JOIN bookmarks
+        ON bookmarks.user_id = @uid AND bookmarks.post_id = posts.id
+    {{end}}`
+
+// postNSFWFilter leaves out the NSFW posts of others when the viewer hides them.
+const postNSFWFilter = `{{if .hide_nsfw}} AND (NOT posts.nsfw OR posts.user_id = @uid){{end}}`
+
+type scanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanPost reads a row selected with postColumns, followed by the extra columns into extra.
+func (s *Service) scanPost(row scanner, auth bool, extra ...interface{}) (Post, error) {
     var p Post
-    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    var u User
+    var avatar sql.NullString
+    var rawEntities []byte
+    dest := []interface{}{&p.ID, &p.UserID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.LikesCount, &p.CreatedAt, &p.EditedAt, &p.CommentsCount, &p.RepostsCount, &p.QuotesCount, &p.QuotedPostID, &p.InReplyToPostID, &p.ConversationID, &p.Visibility, &rawEntities, &u.Username, &avatar}
+    if auth {
+        dest = append(dest, &p.Mine, &p.Liked, &p.Subscribed, &p.Bookmarked)
+    }
+    if err := row.Scan(append(dest, extra...)...); err != nil {
+        return p, err
+    }
+    if err := json.Unmarshal(rawEntities, &p.Entities); err != nil {
+        return p, fmt.Errorf("couldn't unmarshal post entities: %v", err)
+    }
+    if avatar.Valid {
+        avatarURL := s.origin + "/avatars/users/" + avatar.String
+        u.AvatarURL = &avatarURL
+    }
+    p.User = &u
+    return p, nil
+}
+
+//Post is used to fetch a post by its id. NSFW posts are not found by viewers hiding them,
+//nor are posts out of the viewer audience.
+func (s *Service) Post(ctx context.Context, postID int64) (Post, error) {
+    p, err := s.viewablePost(ctx, postID)
+    if err != nil {
+        return p, err
+    }
+    s.recordImpressions(ctx, p.ID)
+    return p, nil
+}
+
+// viewablePost fetches the post as Post does, without counting it as an impression.
+// It's used where the post is only checked or isn't the one being viewed.
+func (s *Service) viewablePost(ctx context.Context, postID int64) (Post, error) {
+    uid, _ := ctx.Value(KeyAuthUserID).(int64)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return Post{}, err
+    }
+    visible, err := postVisible(ctx, s.db, postID, uid, false)
+    if err != nil {
+        return Post{}, err
+    }
+    if !visible {
+        return Post{}, ErrPostNotFound
+    }
+    p, err := s.post(ctx, postID)
+    if err != nil {
+        return p, err
+    }
+    if prefs.hides(p) {
+        return Post{}, ErrPostNotFound
+    }
+    prefs.apply(&p)
+    return p, nil
+}
 
+// post fetches a post by its id regardless of the viewer content preferences and audience.
+func (s *Service) post(ctx context.Context, postID int64) (Post, error) {
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
     query, args, err := buildQuery(`
-        SELECT posts.id, content, spoiler_of, nsfw, likes_count, created_at, comments_count
-        users.username,  users.avatar
-        {{if .auth}}
-        , posts.user_id = @uid AS mine
-        , likes.user_id IS NOT NULL AS liked
-        , subscriptions.user_id IS NOT NULL AS subscribed
-        {{end}}
+        SELECT `+postColumns+`
+        , COALESCE(users.pinned_post_id = posts.id, false) AS pinned
         FROM posts
-        INNER JOIN users ON posts.user_id = users.id
-        {{ if .auth}}
-        LEFT JOIN post_likes AS likes
-        ON likes.user_id = @uid AND likes.post_id = posts.id
-        LEFT JOIN post_subscriptions AS subscriptions
-            ON subscriptions.user_id = @uid AND subscriptions.post_id = posts.id
-        {{end}}
+        `+postJoins+`
         WHERE posts.id = @post_id
     `, map[string]interface{}{
         "auth":    auth,
@@ -75,31 +220,24 @@ func (s *Service) Post(ctx context.Context, postID int64) (Post, error) {
         "post_id": postID,
     })
     if err != nil {
-        return p, fmt.Errorf("Couldn't build find post query: %v", err)
-    }
-    var u User
-    var avatar sql.NullString
-    dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.LikesCount, &p.CreatedAt, &u.Username, &avatar, &p.CommentsCount}
-    if auth {
-        dest = append(dest, &p.Mine, &p.Liked, &p.Subscribed)
+        return Post{}, fmt.Errorf("Couldn't build find post query: %v", err)
     }
-
-    err = s.db.QueryRowContext(ctx, query, args...).Scan(dest...)
+    var pinned bool
+    p, err := s.scanPost(s.db.QueryRowContext(ctx, query, args...), auth, &pinned)
     if err == sql.ErrNoRows {
         return p, ErrPostNotFound
     }
     if err != nil {
         return p, fmt.Errorf("couldn't query select post: %v", err)
     }
-    if avatar.Valid {
-        avatarURL := s.origin + "/avatars/users/" + avatar.String
-        u.AvatarURL = &avatarURL
+    p.Pinned = pinned
+    if err = s.hydratePosts(ctx, &p); err != nil {
+        return p, err
     }
-    p.User = &u
     return p, nil
 }
 
-// Posts of a user in desc ord with backward pagination.
+// Posts of a user in desc ord with backward pagination. The pinned post comes first on the first page.
 func (s *Service) Posts(ctx context.Context, username string, last int,
     before int64) ([]Post, error) {
     username = strings.TrimSpace(username)
@@ -108,30 +246,40 @@ func (s *Service) Posts(ctx context.Context, username string, last int,
     }
     uid, auth := ctx.Value(KeyAuthUserID).(int64)
     last = normalizePageSize(last)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
+    var pinnedPostID sql.NullInt64
+    query := "SELECT pinned_post_id FROM users WHERE username = $1"
+    err = s.db.QueryRowContext(ctx, query, username).Scan(&pinnedPostID)
+    if err != nil && err != sql.ErrNoRows {
+        return nil, fmt.Errorf("couldn't query select pinned post id: %v", err)
+    }
+    // The first page selects the pinned post too, sorted first, with one more row for it.
+    limit := last
+    if pinnedPostID.Valid && before == 0 {
+        limit++
+    }
     query, args, err := buildQuery(`
-        SELECT id, content, spoiler_of, nsfw, likes_count, created_at, comments_count
-        {{if .auth}}
-        , posts.user_id = @uid AS mine
-        , likes.user_id IS NOT NULL AS liked
-        , subscriptions.user_id IS NOT NULL AS subscribed
-        {{end}}
+        SELECT `+postColumns+`
         FROM posts
-        {{ if .auth}}
-        LEFT JOIN post_likes AS likes
-        ON likes.user_id = @uid AND likes.post_id = posts.id
-        LEFT JOIN post_subscriptions AS subscriptions
-            ON subscriptions.user_id = @uid AND subscriptions.post_id = posts.id
-        {{end}}
+        `+postJoins+`
         WHERE posts.user_id = (SELECT id FROM users WHERE username = @username)
+        {{if and .pinned .before}} AND posts.id != @pinned{{end}}
+        AND `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
         {{if .before}} AND posts.id < @before{{end}}
-        ORDER BY created_at DESC
-        LIMIT @last
+        ORDER BY {{if and .pinned (not .before)}}posts.id = @pinned DESC, {{end}}posts.created_at DESC
+        LIMIT @limit
     `, map[string]interface{}{
-        "auth":     auth,
-        "uid":      uid,
-        "username": username,
-        "last":     last,
-        "before":   before,
+        "auth":      auth,
+        "uid":       uid,
+        "username":  username,
+        "limit":     limit,
+        "before":    before,
+        "pinned":    pinnedPostID.Int64,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
     })
     if err != nil {
         return nil, fmt.Errorf("Couldn't build post query: %v", err)
@@ -141,22 +289,32 @@ func (s *Service) Posts(ctx context.Context, username string, last int,
         return nil, fmt.Errorf("Couldn't query select posts: %v", err)
     }
     defer rows.Close()
-    pp := make([]Post, 0, last)
+    pp := make([]Post, 0, limit)
     for rows.Next() {
-        var p Post
-        dest := []interface{}{&p.ID, &p.Content, &p.SpoilerOf, &p.NSFW, &p.LikesCount, &p.CreatedAt, &p.CommentsCount}
-        if auth {
-            dest = append(dest, &p.Mine, &p.Liked, &p.Subscribed)
-        }
-        if err = rows.Scan(dest...); err != nil {
+        p, err := s.scanPost(rows, auth)
+        if err != nil {
             return nil, fmt.Errorf("couldn't scan post: %v", err)
         }
+        p.User = nil
+        p.Pinned = pinnedPostID.Valid && p.ID == pinnedPostID.Int64
         pp = append(pp, p)
     }
     if err = rows.Err(); err != nil {
         return nil, fmt.Errorf("couldn't iterate posts rows: %v", err)
     }
-
+    // The pinned post may be out of the viewer audience, then the extra row is not needed.
+    if len(pp) > last && !pp[0].Pinned {
+        pp = pp[:last]
+    }
+    if err = s.hydratePosts(ctx, postPtrs(pp)...); err != nil {
+        return nil, err
+    }
+    prefs.apply(postPtrs(pp)...)
+    postIDs := make([]int64, len(pp))
+    for i, p := range pp {
+        postIDs[i] = p.ID
+    }
+    s.recordImpressions(ctx, postIDs...)
     return pp, nil
 }
 
@@ -189,7 +347,18 @@ func (s *Service) TogglePostLike(ctx context.Context, postID int64) (ToggleLikeR
         if err = tx.QueryRowContext(ctx, query, postID).Scan(&response.LikesCount); err != nil {
             return response, fmt.Errorf("couldn't update and decrement post likes count: %v", err)
         }
+        query = "UPDATE users SET likes_given_count = likes_given_count - 1 WHERE id = $1"
+        if _, err = tx.ExecContext(ctx, query, uid); err != nil {
+            return response, fmt.Errorf("couldn't update and decrement user likes given count: %v", err)
+        }
     } else {
+        visible, err := postVisible(ctx, tx, postID, uid, false)
+        if err != nil {
+            return response, err
+        }
+        if !visible {
+            return response, ErrPostNotFound
+        }
         query = "INSERT INTO post_likes (user_id, post_id) VALUES ($1, $2)"
         _, err = tx.ExecContext(ctx, query, uid, postID)
 
@@ -203,6 +372,10 @@ func (s *Service) TogglePostLike(ctx context.Context, postID int64) (ToggleLikeR
         if err = tx.QueryRowContext(ctx, query, postID).Scan(&response.LikesCount); err != nil {
             return response, fmt.Errorf("couldn't update and increment post likes count: %v", err)
         }
+        query = "UPDATE users SET likes_given_count = likes_given_count + 1 WHERE id = $1"
+        if _, err = tx.ExecContext(ctx, query, uid); err != nil {
+            return response, fmt.Errorf("couldn't update and increment user likes given count: %v", err)
+        }
 
     }
     if err = tx.Commit(); err != nil {
@@ -213,36 +386,131 @@ func (s *Service) TogglePostLike(ctx context.Context, postID int64) (ToggleLikeR
 }
 
 //CreatePost publishes a post to the user timeline and fans out it to his followers.
-func (s *Service) CreatePost(ctx context.Context, content string, spoilerOf *string, nsfw bool) (TimelineItem, error) {
+func (s *Service) CreatePost(ctx context.Context, in CreatePostInput) (TimelineItem, error) {
     var ti TimelineItem
     uid, ok := ctx.Value(KeyAuthUserID).(int64)
     if !ok {
         return ti, ErrUnauthenticated
     }
-    content = strings.TrimSpace(content)
-    if content == "" || len([]rune(content)) > 480 {
-        return ti, ErrInvalidContent
-    }
-    if spoilerOf != nil {
-        *spoilerOf = strings.TrimSpace(*spoilerOf)
-        if *spoilerOf == "" || len([]rune(*spoilerOf)) > 64 {
-            return ti, ErrInvalidSpoiler
-        }
+    in, err := validateCreatePostInput(in)
+    if err != nil {
+        return ti, err
     }
     tx, err := s.db.BeginTx(ctx, nil)
     if err != nil {
         return ti, fmt.Errorf("Couldn't begin transaction: %v", err)
     }
     defer tx.Rollback()
-    query := "INSERT INTO posts (user_id, content, spoiler_of, nsfw) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
-    if err = tx.QueryRowContext(ctx, query, uid, content, spoilerOf, nsfw).Scan(&ti.Post.ID, &ti.Post.CreatedAt); err != nil {
+    if ti, err = insertPost(ctx, tx, uid, in); err != nil {
+        return ti, err
+    }
+    if err = tx.Commit(); err != nil {
+        return ti, fmt.Errorf("Couldn't commit to create post: %v", err)
+    }
+    if err = s.hydratePosts(ctx, &ti.Post); err != nil {
+        return ti, err
+    }
+    go s.postCreated(ti.Post)
+    return ti, nil
+}
+
+// validateCreatePostInput validates the post and returns it with its content trimmed and media IDs deduplicated.
+func validateCreatePostInput(in CreatePostInput) (CreatePostInput, error) {
+    content, err := validatePost(in.Content, in.SpoilerOf)
+    if err != nil {
+        return in, err
+    }
+    mediaIDs, err := normalizeMediaIDs(in.MediaIDs)
+    if err != nil {
+        return in, err
+    }
+    if err = validatePoll(in.Poll); err != nil {
+        return in, err
+    }
+    if in.Visibility, err = normalizeVisibility(in.Visibility); err != nil {
+        return in, err
+    }
+    in.Content = content
+    in.MediaIDs = mediaIDs
+    return in, nil
+}
+
+// insertPost inserts an already validated post of the user, along with its own timeline item.
+func insertPost(ctx context.Context, tx *sql.Tx, uid int64, in CreatePostInput) (TimelineItem, error) {
+    var ti TimelineItem
+    if in.QuotedPostID != nil {
+        visible, err := postVisible(ctx, tx, *in.QuotedPostID, uid, true)
+        if err != nil {
+            return ti, err
+        }
+        if !visible {
+            return ti, ErrQuotedPostNotFound
+        }
+        query := "UPDATE posts SET quotes_count = quotes_count + 1 WHERE id = $1"
+        if _, err = tx.ExecContext(ctx, query, *in.QuotedPostID); err != nil {
+            return ti, fmt.Errorf("couldn't update and increment quoted post quotes count: %v", err)
+        }
+    }
+    var conversationID *int64
+    if in.InReplyToPostID != nil {
+        query := "SELECT COALESCE(conversation_id, id) FROM posts WHERE id = $1 AND " + visibleTo("$2")
+        err := tx.QueryRowContext(ctx, query, *in.InReplyToPostID, uid).Scan(&conversationID)
+        if err == sql.ErrNoRows {
+            return ti, ErrRepliedPostNotFound
+        }
+        if err != nil {
+            return ti, fmt.Errorf("couldn't query select replied post conversation: %v", err)
+        }
+    }
+    entities, err := collectEntities(ctx, tx, in.Content)
+    if err != nil {
+        return ti, err
+    }
+    rawEntities, err := entitiesJSON(entities)
+    if err != nil {
+        return ti, err
+    }
+    query := `
+        INSERT INTO posts (user_id, content, spoiler_of, nsfw, quoted_post_id, in_reply_to_post_id, conversation_id, visibility, entities)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING id, created_at`
+    err = tx.QueryRowContext(ctx, query, uid, in.Content, in.SpoilerOf, in.NSFW, in.QuotedPostID, in.InReplyToPostID, conversationID, in.Visibility, rawEntities).
+        Scan(&ti.Post.ID, &ti.Post.CreatedAt)
+    if err != nil {
         return ti, fmt.Errorf("couldn't insert post: %v", err)
     }
+    if err = attachMedia(ctx, tx, ti.Post.ID, uid, in.MediaIDs); err != nil {
+        return ti, err
+    }
+    if err = insertPoll(ctx, tx, ti.Post.ID, in.Poll); err != nil {
+        return ti, err
+    }
+    if err = linkMentions(ctx, tx, ti.Post.ID, entities); err != nil {
+        return ti, err
+    }
+    if err = linkHashtags(ctx, tx, ti.Post.ID, in.Content); err != nil {
+        return ti, err
+    }
+    if err = linkPhrases(ctx, tx, ti.Post.ID, in.Content); err != nil {
+        return ti, err
+    }
     ti.Post.UserID = uid
-    ti.Post.Content = content
-    ti.Post.SpoilerOf = spoilerOf
-    ti.Post.NSFW = nsfw
+    ti.Post.Content = in.Content
+    ti.Post.SpoilerOf = in.SpoilerOf
+    ti.Post.NSFW = in.NSFW
+    ti.Post.QuotedPostID = in.QuotedPostID
+    ti.Post.InReplyToPostID = in.InReplyToPostID
+    ti.Post.Visibility = in.Visibility
+    ti.Post.Entities = entities
+    ti.Post.ConversationID = ti.Post.ID
+    if conversationID != nil {
+        ti.Post.ConversationID = *conversationID
+    }
     ti.Post.Mine = true
+    query = "UPDATE users SET posts_count = posts_count + 1 WHERE id = $1"
+    if _, err = tx.ExecContext(ctx, query, uid); err != nil {
+        return ti, fmt.Errorf("couldn't update and increment user posts count: %v", err)
+    }
     query = "INSERT INTO post_subscriptions (user_id, post_id) VALUES ($1, $2)"
     if _, err = tx.ExecContext(ctx, query, uid, ti.Post.ID); err != nil {
         return ti, fmt.Errorf("Couldn't insert post subscription: %v", err)
@@ -254,23 +522,390 @@ func (s *Service) CreatePost(ctx context.Context, content string, spoilerOf *str
     }
     ti.UserID = uid
     ti.PostID = ti.Post.ID
+    return ti, nil
+}
+
+// hydratePosts fills what's stored apart from the posts rows, like quoted posts, media attachments, link previews and polls.
+func (s *Service) hydratePosts(ctx context.Context, pp ...*Post) error {
+    if err := s.hydrateQuotes(ctx, pp...); err != nil {
+        return err
+    }
+    if err := s.hydrateMedia(ctx, pp...); err != nil {
+        return err
+    }
+    if err := s.hydrateLinkPreviews(ctx, pp...); err != nil {
+        return err
+    }
+    return s.hydratePolls(ctx, pp...)
+}
+
+// TogglePostPin pins one of the authenticated user posts to his profile, replacing any previously pinned post.
+func (s *Service) TogglePostPin(ctx context.Context, postID int64) (TogglePinOutput, error) {
+    var out TogglePinOutput
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return out, ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return out, fmt.Errorf("could not begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    var authorID int64
+    query := "SELECT user_id FROM posts WHERE id = $1"
+    err = tx.QueryRowContext(ctx, query, postID).Scan(&authorID)
+    if err == sql.ErrNoRows {
+        return out, ErrPostNotFound
+    }
+    if err != nil {
+        return out, fmt.Errorf("could not query select post author: %v", err)
+    }
+    if authorID != uid {
+        return out, ErrForbiddenPin
+    }
+    query = "SELECT COALESCE(pinned_post_id = $2, false) FROM users WHERE id = $1"
+    if err = tx.QueryRowContext(ctx, query, uid, postID).Scan(&out.Pinned); err != nil {
+        return out, fmt.Errorf("could not query select pinned post: %v", err)
+    }
+    if out.Pinned {
+        query = "UPDATE users SET pinned_post_id = NULL WHERE id = $1"
+        _, err = tx.ExecContext(ctx, query, uid)
+    } else {
+        query = "UPDATE users SET pinned_post_id = $2 WHERE id = $1"
+        _, err = tx.ExecContext(ctx, query, uid, postID)
+    }
+    if err != nil {
+        return out, fmt.Errorf("could not update pinned post: %v", err)
+    }
     if err = tx.Commit(); err != nil {
-        return ti, fmt.Errorf("Couldn't commit to create post: %v", err)
+        return out, fmt.Errorf("could not commit to toggle post pin: %v", err)
     }
-    go s.postCreated(ti.Post)
-    return ti, nil
+    out.Pinned = !out.Pinned
+    return out, nil
+}
+
+// validatePost trims the content and spoiler, returning the trimmed content.
+func validatePost(content string, spoilerOf *string) (string, error) {
+    content = strings.TrimSpace(content)
+    if content == "" || len([]rune(content)) > 480 {
+        return "", ErrInvalidContent
+    }
+    if spoilerOf != nil {
+        *spoilerOf = strings.TrimSpace(*spoilerOf)
+        if *spoilerOf == "" || len([]rune(*spoilerOf)) > 64 {
+            return "", ErrInvalidSpoiler
+        }
+    }
+    return content, nil
+}
+
+//UpdatePost edits a post of the authenticated user within the edit window, keeping its previous version.
+//Only the fields given in the input change.
+func (s *Service) UpdatePost(ctx context.Context, postID int64, in UpdatePostInput) (Post, error) {
+    var p Post
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return p, ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return p, fmt.Errorf("Couldn't begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+    var old PostEdit
+    var authorID int64
+    var createdAt time.Time
+    var rawOldEntities []byte
+    query := "SELECT user_id, content, spoiler_of, nsfw, entities, created_at FROM posts WHERE id = $1 FOR UPDATE"
+    err = tx.QueryRowContext(ctx, query, postID).Scan(&authorID, &old.Content, &old.SpoilerOf, &old.NSFW, &rawOldEntities, &createdAt)
+    if err == sql.ErrNoRows {
+        return p, ErrPostNotFound
+    }
+    if err != nil {
+        return p, fmt.Errorf("couldn't query select post to edit: %v", err)
+    }
+    if authorID != uid {
+        return p, ErrForbiddenPostEdit
+    }
+    if time.Since(createdAt) > s.postEditWindow {
+        return p, ErrPostEditWindowExpired
+    }
+    var oldEntities []Entity
+    if err = json.Unmarshal(rawOldEntities, &oldEntities); err != nil {
+        return p, fmt.Errorf("couldn't unmarshal post entities: %v", err)
+    }
+    content, spoilerOf, nsfw := old.Content, old.SpoilerOf, old.NSFW
+    if in.Content != nil {
+        content = *in.Content
+    }
+    if in.SpoilerOf != nil {
+        spoilerOf = nil
+        if strings.TrimSpace(*in.SpoilerOf) != "" {
+            spoilerOf = in.SpoilerOf
+        }
+    }
+    if in.NSFW != nil {
+        nsfw = *in.NSFW
+    }
+    content, err = validatePost(content, spoilerOf)
+    if err != nil {
+        return p, err
+    }
+    query = "INSERT INTO post_edits (post_id, content, spoiler_of, nsfw) VALUES ($1, $2, $3, $4)"
+    if _, err = tx.ExecContext(ctx, query, postID, old.Content, old.SpoilerOf, old.NSFW); err != nil {
+        return p, fmt.Errorf("couldn't insert post edit: %v", err)
+    }
+    entities, err := collectEntities(ctx, tx, content)
+    if err != nil {
+        return p, err
+    }
+    rawEntities, err := entitiesJSON(entities)
+    if err != nil {
+        return p, err
+    }
+    query = "UPDATE posts SET content = $1, spoiler_of = $2, nsfw = $3, entities = $4, edited_at = now() WHERE id = $5"
+    if _, err = tx.ExecContext(ctx, query, content, spoilerOf, nsfw, rawEntities, postID); err != nil {
+        return p, fmt.Errorf("couldn't update post: %v", err)
+    }
+    if err = unlinkMentions(ctx, tx, postID); err != nil {
+        return p, err
+    }
+    if err = linkMentions(ctx, tx, postID, entities); err != nil {
+        return p, err
+    }
+    if err = unlinkHashtags(ctx, tx, postID); err != nil {
+        return p, err
+    }
+    if err = linkHashtags(ctx, tx, postID, content); err != nil {
+        return p, err
+    }
+    if err = unlinkPhrases(ctx, tx, postID); err != nil {
+        return p, err
+    }
+    if err = linkPhrases(ctx, tx, postID, content); err != nil {
+        return p, err
+    }
+    if err = tx.Commit(); err != nil {
+        return p, fmt.Errorf("Couldn't commit to update post: %v", err)
+    }
+    p, err = s.viewablePost(ctx, postID)
+    if err != nil {
+        return p, err
+    }
+    go s.postUpdated(postID, oldEntities)
+    return p, nil
+}
+
+//PostHistory lists the previous versions of a post in desc order with backward pagination.
+func (s *Service) PostHistory(ctx context.Context, postID int64, last int, before int64) ([]PostEdit, error) {
+    if _, err := s.viewablePost(ctx, postID); err != nil {
+        return nil, err
+    }
+    last = normalizePageSize(last)
+    query, args, err := buildQuery(`
+        SELECT id, content, spoiler_of, nsfw, edited_at
+        FROM post_edits
+        WHERE post_id = @post_id
+        {{if .before}}AND id < @before{{end}}
+        ORDER BY id DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "post_id": postID,
+        "last":    last,
+        "before":  before,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("Couldn't build post history query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("Couldn't query select post edits: %v", err)
+    }
+    defer rows.Close()
+    ee := make([]PostEdit, 0, last)
+    for rows.Next() {
+        var e PostEdit
+        if err = rows.Scan(&e.ID, &e.Content, &e.SpoilerOf, &e.NSFW, &e.EditedAt); err != nil {
+            return nil, fmt.Errorf("couldn't scan post edit: %v", err)
+        }
+        ee = append(ee, e)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate post edit rows: %v", err)
+    }
+    return ee, nil
 }
-func (s *Service) postCreated(p Post) {
+
+// postUpdated pushes the edited post loaded with no viewer,
+// so nothing specific to the editor reaches the other clients.
+func (s *Service) postUpdated(postID int64, oldEntities []Entity) {
+    p, err := s.post(context.Background(), postID)
+    if err != nil {
+        log.Printf("couldn't get updated post: %v\n", err)
+        return
+    }
+    p.Pinned = false
+    go s.broadcastPostEvent(p, TimelineItemEventUpdated)
+    go s.fanoutListPost(p, TimelineItemEventUpdated)
+    mentioned := map[int64]struct{}{}
+    for _, id := range mentionedUserIDs(oldEntities) {
+        mentioned[id] = struct{}{}
+    }
+    newMentions := []int64{}
+    for _, id := range mentionedUserIDs(p.Entities) {
+        if _, ok := mentioned[id]; !ok {
+            newMentions = append(newMentions, id)
+        }
+    }
+    go s.notifyPostMention(p, newMentions)
+    go s.unfurlPost(p)
+}
+
+//DeletePost deletes a post along with everything referencing it. Moderators can delete posts of other users.
+func (s *Service) DeletePost(ctx context.Context, postID int64) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("Couldn't begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+    var authorID int64
+    query := "SELECT user_id FROM posts WHERE id = $1 FOR UPDATE"
+    err = tx.QueryRowContext(ctx, query, postID).Scan(&authorID)
+    if err == sql.ErrNoRows {
+        return ErrPostNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("couldn't query select post to delete: %v", err)
+    }
+    if authorID != uid {
+        err = s.authorizeRole(ctx, roleModerator, roleAdmin)
+        if err == ErrForbidden {
+            return ErrForbiddenPostDelete
+        }
+        if err != nil {
+            return err
+        }
+    }
+    tt, err := deletePostCascade(ctx, tx, postID, authorID)
+    if err != nil {
+        return err
+    }
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("Couldn't commit to delete post: %v", err)
+    }
+    go s.postDeleted(Post{ID: postID, UserID: authorID}, tt)
+    return nil
+}
+
+// deletePostCascade deletes the post and its dependent rows, keeping the users counters in sync.
+// It returns the deleted timeline items so their subscribers can be told.
+func deletePostCascade(ctx context.Context, tx *sql.Tx, postID, authorID int64) ([]TimelineItem, error) {
+    queries := []struct {
+        query string
+        what  string
+    }{
+        {"UPDATE users SET pinned_post_id = NULL WHERE pinned_post_id = $1", "unpin post"},
+        {"UPDATE posts SET quotes_count = quotes_count - 1 WHERE id = (SELECT quoted_post_id FROM posts WHERE id = $1)", "decrement quoted post quotes count"},
+        {"UPDATE users SET posts_count = posts_count - 1 WHERE id = (SELECT user_id FROM posts WHERE id = $1)", "decrement author posts count"},
+        {"UPDATE users SET likes_given_count = likes_given_count - 1 WHERE id IN (SELECT user_id FROM post_likes WHERE post_id = $1)", "decrement likers likes given count"},
+        {`UPDATE users SET comments_count = comments_count - commenters.n
+            FROM (SELECT user_id, count(*) AS n FROM comments WHERE post_id = $1 GROUP BY user_id) AS commenters
+            WHERE users.id = commenters.user_id`, "decrement commenters comments count"},
+        {"DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = $1)", "delete comment likes"},
+        {"DELETE FROM comments WHERE post_id = $1", "delete comments"},
+        {"DELETE FROM post_likes WHERE post_id = $1", "delete post likes"},
+        {"DELETE FROM post_subscriptions WHERE post_id = $1", "delete post subscriptions"},
+        {"DELETE FROM bookmarks WHERE post_id = $1", "delete bookmarks"},
+        {"DELETE FROM notifications WHERE post_id = $1", "delete post notifications"},
+        {"DELETE FROM post_edits WHERE post_id = $1", "delete post edits"},
+        {"DELETE FROM reposts WHERE post_id = $1", "delete reposts"},
+        {"UPDATE hashtags SET usage_count = usage_count - 1 WHERE id IN (SELECT hashtag_id FROM post_hashtags WHERE post_id = $1)", "decrement hashtags usage count"},
+        {"DELETE FROM post_hashtags WHERE post_id = $1", "delete post hashtags"},
+        {"DELETE FROM post_phrases WHERE post_id = $1", "delete post phrases"},
+        {"DELETE FROM post_mentions WHERE post_id = $1", "delete post mentions"},
+        {"DELETE FROM post_engagements WHERE post_id = $1", "delete post engagements"},
+        {"DELETE FROM poll_votes WHERE post_id = $1", "delete poll votes"},
+        {"DELETE FROM poll_options WHERE post_id = $1", "delete poll options"},
+        {"DELETE FROM polls WHERE post_id = $1", "delete poll"},
+    }
+    for _, q := range queries {
+        if _, err := tx.ExecContext(ctx, q.query, postID); err != nil {
+            return nil, fmt.Errorf("couldn't %s: %v", q.what, err)
+        }
+    }
+    rows, err := tx.QueryContext(ctx, "DELETE FROM timeline WHERE post_id = $1 RETURNING id, user_id", postID)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't delete post timeline items: %v", err)
+    }
+    defer rows.Close()
+    tt := []TimelineItem{}
+    for rows.Next() {
+        ti := TimelineItem{PostID: postID, Post: Post{ID: postID, UserID: authorID}, Event: TimelineItemEventDeleted}
+        if err = rows.Scan(&ti.ID, &ti.UserID); err != nil {
+            return nil, fmt.Errorf("couldn't scan deleted timeline item: %v", err)
+        }
+        tt = append(tt, ti)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate deleted timeline items: %v", err)
+    }
+    if _, err = tx.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", postID); err != nil {
+        return nil, fmt.Errorf("couldn't delete post: %v", err)
+    }
+    return tt, nil
+}
+
+func (s *Service) postDeleted(p Post, tt []TimelineItem) {
+    for _, ti := range tt {
+        go s.broadcastTimelineItem(ti)
+    }
+    go s.fanoutListPost(p, TimelineItemEventDeleted)
+}
+
+// broadcastPostEvent pushes the post to the timeline subscribers who already received it.
+func (s *Service) broadcastPostEvent(p Post, event string) {
+    rows, err := s.db.Query("SELECT id, user_id FROM timeline WHERE post_id = $1", p.ID)
+    if err != nil {
+        log.Printf("couldn't query select post timeline items: %v", err)
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        ti := TimelineItem{PostID: p.ID, Post: p, Event: event}
+        if err = rows.Scan(&ti.ID, &ti.UserID); err != nil {
+            log.Printf("couldn't scan post timeline item: %v", err)
+            return
+        }
+        go s.broadcastTimelineItem(ti)
+    }
+    if err = rows.Err(); err != nil {
+        log.Printf("couldn't iterate over post timeline items: %v", err)
+        return
+    }
+}
+
+// postCreated fans out the post to the followers timelines before returning,
+// the rest of the side effects run in the background. It reports whether the fanout got done.
+func (s *Service) postCreated(p Post) bool {
     u, err := s.userByID(context.Background(), p.UserID)
     if err != nil {
         log.Printf("couldn't get post user: %v\n", err)
-        return
+        return false
     }
     p.User = &u
     p.Mine = false
     p.Subscribed = false
-    go s.fanoutPost(p)
-    go s.notifyPostMention(p)
+    go s.fanoutListPost(p, TimelineItemEventCreated)
+    go s.notifyPostMention(p, mentionedUserIDs(p.Entities))
+    go s.unfurlPost(p)
+    if p.InReplyToPostID != nil {
+        go s.notifyReply(p)
+    }
+    return s.fanoutPost(p, nil)
 }
 
 // TogglePostSubscription so you can stop receiving notifications from a thread.
@@ -288,6 +923,15 @@ func (s *Service) TogglePostSubscription(ctx context.Context, postID int64) (Tog
 
     defer tx.Rollback()
 
+    visible, err := postVisible(ctx, tx, postID, uid, false)
+    if err != nil {
+        return out, err
+    }
+
+    if !visible {
+        return out, ErrPostNotFound
+    }
+
     query := `SELECT EXISTS (
         SELECT 1 FROM post_subscriptions WHERE user_id = $1 AND post_id = $2
     )`
@@ -320,26 +964,54 @@ func (s *Service) TogglePostSubscription(ctx context.Context, postID int64) (Tog
 
     return out, nil
 }
-func (s *Service) fanoutPost(p Post) {
-    query := "INSERT INTO timeline (user_id, post_id) SELECT follower_id, $1 FROM follows WHERE followee_id = $2 RETURNING id, user_id"
-    rows, err := s.db.Query(query, p.ID, p.UserID)
+
+// fanoutPost inserts the post into the timeline of the author followers, or of the reposter followers when reposted.
+// Replies only reach the followers of both participants. Followers out of the post audience are left out.
+// Followers that already have the post on their timeline are skipped. It reports whether every timeline got the post.
+func (s *Service) fanoutPost(p Post, repostedBy *User) bool {
+    fanoutUserID := p.UserID
+    var repostedByID *int64
+    if repostedBy != nil {
+        fanoutUserID = repostedBy.ID
+        repostedByID = &repostedBy.ID
+    }
+    query := `
+        INSERT INTO timeline (user_id, post_id, reposted_by_id)
+        SELECT follower_id, posts.id, $3 FROM follows, posts
+        WHERE posts.id = $1 AND followee_id = $2 AND ` + visibleTo("follows.follower_id")
+    args := []interface{}{p.ID, fanoutUserID, repostedByID}
+    if repostedBy == nil && p.InReplyToPostID != nil {
+        query += `
+            AND follower_id IN (
+                SELECT follower_id FROM follows
+                WHERE followee_id = (SELECT user_id FROM posts WHERE id = $4)
+            )`
+        args = append(args, *p.InReplyToPostID)
+    }
+    query += `
+        ON CONFLICT (user_id, post_id) DO NOTHING
+        RETURNING id, user_id`
+    rows, err := s.db.Query(query, args...)
     if err != nil {
         log.Printf("couldn't insert timeline: %v", err)
-        return
+        return false
     }
     defer rows.Close()
     for rows.Next() {
         var ti TimelineItem
         if err = rows.Scan(&ti.ID, &ti.UserID); err != nil {
             log.Printf("Couldn't scan timeline item: %v", err)
-            return
+            return false
         }
         ti.PostID = p.ID
         ti.Post = p
+        ti.RepostedBy = repostedBy
+        ti.Event = TimelineItemEventCreated
         go s.broadcastTimelineItem(ti)
     }
     if err = rows.Err(); err != nil {
         log.Printf("couldn't iterate over timelines: %v", err)
-        return
+        return false
     }
+    return true
 }
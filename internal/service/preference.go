@@ -0,0 +1,121 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+)
+
+const (
+    //NSFWHide leaves NSFW posts out.
+    NSFWHide = "hide"
+    //NSFWBlur keeps NSFW posts, flagged so clients blur them.
+    NSFWBlur = "blur"
+    //NSFWShow shows NSFW posts as any other post.
+    NSFWShow = "show"
+)
+
+var (
+    //ErrInvalidNSFWPreference is used to indicate that the NSFW preference isn't one of hide, blur or show.
+    ErrInvalidNSFWPreference = errors.New("nsfw preference must be one of hide, blur or show")
+)
+
+// ContentPreferences of a viewer about sensitive content.
+type ContentPreferences struct {
+    NSFW           string `json:"nsfw"`
+    ExpandSpoilers bool   `json:"expand_spoilers"`
+}
+
+// anonymousContentPreferences apply to unauthenticated viewers.
+var anonymousContentPreferences = ContentPreferences{NSFW: NSFWHide}
+
+//ContentPreferences of the authenticated user.
+func (s *Service) ContentPreferences(ctx context.Context) (ContentPreferences, error) {
+    if _, ok := ctx.Value(KeyAuthUserID).(int64); !ok {
+        return ContentPreferences{}, ErrUnauthenticated
+    }
+    return s.contentPreferences(ctx)
+}
+
+//UpdateContentPreferences of the authenticated user.
+func (s *Service) UpdateContentPreferences(ctx context.Context, prefs ContentPreferences) (ContentPreferences, error) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return prefs, ErrUnauthenticated
+    }
+    if prefs.NSFW != NSFWHide && prefs.NSFW != NSFWBlur && prefs.NSFW != NSFWShow {
+        return prefs, ErrInvalidNSFWPreference
+    }
+    query := "UPDATE users SET nsfw_preference = $1, expand_spoilers = $2 WHERE id = $3"
+    if _, err := s.db.ExecContext(ctx, query, prefs.NSFW, prefs.ExpandSpoilers, uid); err != nil {
+        return prefs, fmt.Errorf("couldn't update content preferences: %v", err)
+    }
+    return prefs, nil
+}
+
+// contentPreferences of the viewer, the anonymous ones when unauthenticated.
+func (s *Service) contentPreferences(ctx context.Context) (ContentPreferences, error) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return anonymousContentPreferences, nil
+    }
+    var prefs ContentPreferences
+    query := "SELECT nsfw_preference, expand_spoilers FROM users WHERE id = $1"
+    if err := s.db.QueryRowContext(ctx, query, uid).Scan(&prefs.NSFW, &prefs.ExpandSpoilers); err != nil {
+        return prefs, fmt.Errorf("couldn't query select content preferences: %v", err)
+    }
+    return prefs, nil
+}
+
+// hides tells whether the post should be left out for the viewer. Authors always see their own posts.
+func (prefs ContentPreferences) hides(p Post) bool {
+    return prefs.NSFW == NSFWHide && p.NSFW && !p.Mine
+}
+
+// applyToTimelineItem applies the preferences to a pushed timeline item, telling whether it should be pushed at all.
+// A post edited into NSFW is pushed as deleted to viewers hiding it.
+func (prefs ContentPreferences) applyToTimelineItem(ti TimelineItem, uid int64) (TimelineItem, bool) {
+    if ti.Event == TimelineItemEventDeleted {
+        return ti, true
+    }
+    p := ti.Post
+    p.Mine = p.UserID == uid
+    if p.Quote != nil {
+        q := *p.Quote
+        q.Mine = q.UserID == uid
+        p.Quote = &q
+    }
+    if prefs.hides(p) {
+        if ti.Event == TimelineItemEventUpdated {
+            ti.Event = TimelineItemEventDeleted
+            ti.Post = Post{ID: p.ID}
+            return ti, true
+        }
+        return ti, false
+    }
+    prefs.apply(&p)
+    ti.Post.Blur = p.Blur
+    ti.Post.ExpandSpoiler = p.ExpandSpoiler
+    ti.Post.Quote = p.Quote
+    return ti, true
+}
+
+// apply flags the posts and their quoted posts to be blurred or have their spoiler expanded.
+// Quoted posts the viewer hides are tombstoned.
+func (prefs ContentPreferences) apply(pp ...*Post) {
+    for _, p := range pp {
+        p.Blur = prefs.NSFW == NSFWBlur && p.NSFW && !p.Mine
+        p.ExpandSpoiler = prefs.ExpandSpoilers && p.SpoilerOf != nil
+        if p.Quote == nil || p.Quote.Tombstone {
+            continue
+        }
+        q := *p.Quote
+        if prefs.NSFW == NSFWHide && q.NSFW && !q.Mine {
+            p.Quote = &QuotedPost{ID: q.ID, Tombstone: true}
+            continue
+        }
+        q.Blur = prefs.NSFW == NSFWBlur && q.NSFW && !q.Mine
+        q.ExpandSpoiler = prefs.ExpandSpoilers && q.SpoilerOf != nil
+        p.Quote = &q
+    }
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// QuotedPost is the snapshot of a quoted post embedded into the quoting one.
+// When the quoted post is no longer available it's returned as a tombstone with only its ID.
+type QuotedPost struct {
+    ID            int64      `json:"id"`
+    UserID        int64      `json:"-"`
+    Content       string     `json:"content,omitempty"`
+    SpoilerOf     *string    `json:"spoiler_of,omitempty"`
+    NSFW          bool       `json:"nsfw"`
+    CreatedAt     *time.Time `json:"created_at,omitempty"`
+    User          *User      `json:"user,omitempty"`
+    Mine          bool       `json:"-"`
+    Blur          bool       `json:"blur"`
+    ExpandSpoiler bool       `json:"expand_spoiler"`
+    Tombstone     bool       `json:"tombstone"`
+}
+
+//Quotes of a post in desc order with backward pagination.
+func (s *Service) Quotes(ctx context.Context, postID int64, last int, before int64) ([]Post, error) {
+    if _, err := s.viewablePost(ctx, postID); err != nil {
+        return nil, err
+    }
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    last = normalizePageSize(last)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
+    query, args, err := buildQuery(`
+        SELECT `+postColumns+`
+        FROM posts
+        `+postJoins+`
+        WHERE posts.quoted_post_id = @post_id
+        AND `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
+        {{if .before}} AND posts.id < @before{{end}}
+        ORDER BY posts.created_at DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "auth":      auth,
+        "uid":       uid,
+        "post_id":   postID,
+        "last":      last,
+        "before":    before,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build quotes query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select quotes: %v", err)
+    }
+    defer rows.Close()
+    pp := make([]Post, 0, last)
+    for rows.Next() {
+        p, err := s.scanPost(rows, auth)
+        if err != nil {
+            return nil, fmt.Errorf("couldn't scan quote: %v", err)
+        }
+        pp = append(pp, p)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate quotes rows: %v", err)
+    }
+    if err = s.hydratePosts(ctx, postPtrs(pp)...); err != nil {
+        return nil, err
+    }
+    prefs.apply(postPtrs(pp)...)
+    return pp, nil
+}
+
+// hydrateQuotes fills the quoted post snapshot of the given posts with a single query.
+// Quoted posts out of the viewer audience are tombstoned as the deleted ones.
+func (s *Service) hydrateQuotes(ctx context.Context, pp ...*Post) error {
+    uid, _ := ctx.Value(KeyAuthUserID).(int64)
+    ids := []int64{}
+    for _, p := range pp {
+        if p.QuotedPostID != nil {
+            ids = append(ids, *p.QuotedPostID)
+        }
+    }
+    if len(ids) == 0 {
+        return nil
+    }
+    query := `
+        SELECT posts.id, posts.user_id, posts.content, posts.spoiler_of, posts.nsfw, posts.created_at, users.username, users.avatar
+        FROM posts
+        INNER JOIN users ON posts.user_id = users.id
+        WHERE posts.id = ANY($1) AND ` + visibleTo("$2")
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), uid)
+    if err != nil {
+        return fmt.Errorf("couldn't query select quoted posts: %v", err)
+    }
+    defer rows.Close()
+    quoted := map[int64]*QuotedPost{}
+    for rows.Next() {
+        var q QuotedPost
+        var u User
+        var avatar sql.NullString
+        if err = rows.Scan(&q.ID, &q.UserID, &q.Content, &q.SpoilerOf, &q.NSFW, &q.CreatedAt, &u.Username, &avatar); err != nil {
+            return fmt.Errorf("couldn't scan quoted post: %v", err)
+        }
+        if avatar.Valid {
+            avatarURL := s.origin + "/avatars/users/" + avatar.String
+            u.AvatarURL = &avatarURL
+        }
+        q.User = &u
+        q.Mine = q.UserID == uid
+        quoted[q.ID] = &q
+    }
+    if err = rows.Err(); err != nil {
+        return fmt.Errorf("couldn't iterate quoted posts rows: %v", err)
+    }
+    for _, p := range pp {
+        if p.QuotedPostID == nil {
+            continue
+        }
+        if q, ok := quoted[*p.QuotedPostID]; ok {
+            p.Quote = q
+            continue
+        }
+        p.Quote = &QuotedPost{ID: *p.QuotedPostID, Tombstone: true}
+    }
+    return nil
+}
+
+func postPtrs(pp []Post) []*Post {
+    out := make([]*Post, len(pp))
+    for i := range pp {
+        out[i] = &pp[i]
+    }
+    return out
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+
+    "github.com/lib/pq"
+)
+
+// RepostResponse is used to formulate the repost response.
+type RepostResponse struct {
+    Reposted     bool `json:"reposted"`
+    RepostsCount int  `json:"reposts_count"`
+}
+
+//Repost shares a post with the authenticated user followers. Posts out of the user audience can't be reposted.
+func (s *Service) Repost(ctx context.Context, postID int64) (RepostResponse, error) {
+    var response RepostResponse
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return response, ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return response, fmt.Errorf("Couldn't start transaction: %v", err)
+    }
+    defer tx.Rollback()
+    visible, err := postVisible(ctx, tx, postID, uid, true)
+    if err != nil {
+        return response, err
+    }
+    if !visible {
+        return response, ErrPostNotFound
+    }
+    query := "INSERT INTO reposts (user_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+    result, err := tx.ExecContext(ctx, query, uid, postID)
+    if isForeignKeyViolation(err) {
+        return response, ErrPostNotFound
+    }
+    if err != nil {
+        return response, fmt.Errorf("couldn't insert repost: %v", err)
+    }
+    inserted, _ := result.RowsAffected()
+    if inserted == 0 {
+        query = "SELECT reposts_count FROM posts WHERE id = $1"
+    } else {
+        query = "UPDATE posts SET reposts_count = reposts_count + 1 WHERE id = $1 RETURNING reposts_count"
+    }
+    if err = tx.QueryRowContext(ctx, query, postID).Scan(&response.RepostsCount); err != nil {
+        return response, fmt.Errorf("couldn't update and increment post reposts count: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return response, fmt.Errorf("couldn't commit repost: %v", err)
+    }
+    response.Reposted = true
+    if inserted != 0 {
+        go s.repostCreated(postID, uid)
+    }
+    return response, nil
+}
+
+//DeleteRepost undoes a repost of the authenticated user, removing it from the followers timelines it reached.
+func (s *Service) DeleteRepost(ctx context.Context, postID int64) (RepostResponse, error) {
+    var response RepostResponse
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return response, ErrUnauthenticated
+    }
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return response, fmt.Errorf("Couldn't start transaction: %v", err)
+    }
+    defer tx.Rollback()
+    query := "DELETE FROM reposts WHERE user_id = $1 AND post_id = $2"
+    result, err := tx.ExecContext(ctx, query, uid, postID)
+    if err != nil {
+        return response, fmt.Errorf("couldn't delete repost: %v", err)
+    }
+    deleted, _ := result.RowsAffected()
+    if deleted == 0 {
+        query = "SELECT reposts_count FROM posts WHERE id = $1"
+    } else {
+        query = "UPDATE posts SET reposts_count = reposts_count - 1 WHERE id = $1 RETURNING reposts_count"
+    }
+    err = tx.QueryRowContext(ctx, query, postID).Scan(&response.RepostsCount)
+    if err == sql.ErrNoRows {
+        return response, ErrPostNotFound
+    }
+    if err != nil {
+        return response, fmt.Errorf("couldn't update and decrement post reposts count: %v", err)
+    }
+    query = "DELETE FROM timeline WHERE post_id = $1 AND reposted_by_id = $2 RETURNING id, user_id"
+    rows, err := tx.QueryContext(ctx, query, postID, uid)
+    if err != nil {
+        return response, fmt.Errorf("couldn't delete repost timeline items: %v", err)
+    }
+    defer rows.Close()
+    tt := []TimelineItem{}
+    for rows.Next() {
+        ti := TimelineItem{PostID: postID, Post: Post{ID: postID}, Event: TimelineItemEventDeleted}
+        if err = rows.Scan(&ti.ID, &ti.UserID); err != nil {
+            return response, fmt.Errorf("couldn't scan deleted repost timeline item: %v", err)
+        }
+        tt = append(tt, ti)
+    }
+    if err = rows.Err(); err != nil {
+        return response, fmt.Errorf("couldn't iterate deleted repost timeline items: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return response, fmt.Errorf("couldn't commit to delete repost: %v", err)
+    }
+    for _, ti := range tt {
+        go s.broadcastTimelineItem(ti)
+    }
+    return response, nil
+}
+
+func (s *Service) repostCreated(postID, reposterID int64) {
+    ctx := context.Background()
+    p, err := s.post(ctx, postID)
+    if err != nil {
+        log.Printf("couldn't get reposted post: %v\n", err)
+        return
+    }
+    p.Pinned = false
+    u, err := s.userByID(ctx, reposterID)
+    if err != nil {
+        log.Printf("couldn't get reposter: %v\n", err)
+        return
+    }
+    go s.fanoutPost(p, &u)
+    go s.notifyRepost(p, u)
+}
+
+func (s *Service) notifyRepost(p Post, reposter User) {
+    if p.UserID == reposter.ID {
+        return
+    }
+    actor := reposter.Username
+    var n Notification
+    query := `
+        INSERT INTO notifications (user_id, actors, type, post_id) VALUES ($1, $2, 'repost', $3)
+        ON CONFLICT (user_id, type, post_id) WHERE NOT read DO UPDATE SET
+            actors = array_prepend($4, array_remove(notifications.actors, $4)),
+            issued_at = now()
+        RETURNING id, actors, issued_at`
+    err := s.db.QueryRow(query, p.UserID, pq.Array([]string{actor}), p.ID, actor).Scan(&n.ID, pq.Array(&n.Actors), &n.IssuedAt)
+    if err != nil {
+        log.Printf("couldn't insert repost notification: %v\n", err)
+        return
+    }
+    n.UserID = p.UserID
+    n.Type = "repost"
+    n.PostID = &p.ID
+    go s.broadcastNotification(n)
+}
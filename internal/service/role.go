@@ -0,0 +1,48 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+)
+
+const (
+    roleUser      = "user"
+    roleModerator = "moderator"
+    roleAdmin     = "admin"
+)
+
+//ErrForbidden is used to indicate that the authenticated user role isn't allowed to do this.
+var ErrForbidden = errors.New("forbidden")
+
+// authorizeRole makes sure the authenticated user has one of the given roles.
+func (s *Service) authorizeRole(ctx context.Context, roles ...string) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    role, err := s.userRole(ctx, uid)
+    if err != nil {
+        return err
+    }
+    for _, r := range roles {
+        if r == role {
+            return nil
+        }
+    }
+    return ErrForbidden
+}
+
+func (s *Service) userRole(ctx context.Context, uid int64) (string, error) {
+    var role string
+    query := "SELECT role FROM users WHERE id = $1"
+    err := s.db.QueryRowContext(ctx, query, uid).Scan(&role)
+    if err == sql.ErrNoRows {
+        return "", ErrUserNotFound
+    }
+    if err != nil {
+        return "", fmt.Errorf("couldn't query select user role: %v", err)
+    }
+    return role, nil
+}
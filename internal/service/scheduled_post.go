@@ -0,0 +1,390 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+const (
+    scheduledPostsInterval = time.Second * 30
+    maxScheduleAhead       = time.Hour * 24 * 365
+)
+
+const (
+    scheduledPostStatusScheduled = "scheduled"
+    scheduledPostStatusPublished = "published"
+    scheduledPostStatusFailed    = "failed"
+)
+
+var (
+    //ErrInvalidPublishAt is used to indicate that the publish time isn't in the future or is too far in it.
+    ErrInvalidPublishAt = errors.New("publish_at must be in the future and within a year")
+    //ErrScheduledPostNotFound denotes a not found, already published or cancelled scheduled post.
+    ErrScheduledPostNotFound = errors.New("scheduled post not found")
+)
+
+// ScheduledPost model, a post waiting to be published at its due time.
+type ScheduledPost struct {
+    ID              int64      `json:"id"`
+    UserID          int64      `json:"-"`
+    Content         string     `json:"content"`
+    SpoilerOf       *string    `json:"spoiler_of"`
+    NSFW            bool       `json:"nsfw"`
+    QuotedPostID    *int64     `json:"quoted_post_id"`
+    InReplyToPostID *int64     `json:"in_reply_to_post_id"`
+    MediaIDs        []int64    `json:"media_ids"`
+    Poll            *PollInput `json:"poll,omitempty"`
+    Visibility      string     `json:"visibility"`
+    PublishAt       time.Time  `json:"publish_at"`
+    Status          string     `json:"status"`
+    PostID          *int64     `json:"post_id,omitempty"`
+    CreatedAt       time.Time  `json:"created_at"`
+}
+
+//SchedulePost stores a post of the authenticated user to be published at publishAt.
+func (s *Service) SchedulePost(ctx context.Context, in CreatePostInput, publishAt time.Time) (ScheduledPost, error) {
+    var sp ScheduledPost
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return sp, ErrUnauthenticated
+    }
+    in, err := s.validateScheduledPost(ctx, uid, in, publishAt)
+    if err != nil {
+        return sp, err
+    }
+    query := `
+        INSERT INTO scheduled_posts (user_id, content, spoiler_of, nsfw, quoted_post_id, in_reply_to_post_id, media_ids, poll_options, poll_duration_minutes, visibility, publish_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        RETURNING id, status, created_at`
+    pollOptions, pollDuration := scheduledPollColumns(in.Poll)
+    err = s.db.QueryRowContext(ctx, query, uid, in.Content, in.SpoilerOf, in.NSFW, in.QuotedPostID, in.InReplyToPostID, pq.Array(in.MediaIDs), pollOptions, pollDuration, in.Visibility, publishAt).
+        Scan(&sp.ID, &sp.Status, &sp.CreatedAt)
+    if err != nil {
+        return sp, fmt.Errorf("couldn't insert scheduled post: %v", err)
+    }
+    sp.UserID = uid
+    sp.Content = in.Content
+    sp.SpoilerOf = in.SpoilerOf
+    sp.NSFW = in.NSFW
+    sp.QuotedPostID = in.QuotedPostID
+    sp.InReplyToPostID = in.InReplyToPostID
+    sp.MediaIDs = in.MediaIDs
+    sp.Poll = in.Poll
+    sp.Visibility = in.Visibility
+    sp.PublishAt = publishAt
+    return sp, nil
+}
+
+//ScheduledPosts of the authenticated user still waiting to be published, soonest first with forward pagination.
+func (s *Service) ScheduledPosts(ctx context.Context, first int, after int64) ([]ScheduledPost, error) {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return nil, ErrUnauthenticated
+    }
+    first = normalizePageSize(first)
+    query, args, err := buildQuery(`
+        SELECT id, content, spoiler_of, nsfw, quoted_post_id, in_reply_to_post_id, media_ids, poll_options, poll_duration_minutes, visibility, publish_at, status, created_at
+        FROM scheduled_posts
+        WHERE user_id = @uid AND status = 'scheduled'
+        {{if .after}}
+        AND (publish_at, id) > (SELECT publish_at, id FROM scheduled_posts WHERE id = @after)
+        {{end}}
+        ORDER BY publish_at ASC, id ASC
+        LIMIT @first
+    `, map[string]interface{}{
+        "uid":   uid,
+        "first": first,
+        "after": after,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build scheduled posts query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select scheduled posts: %v", err)
+    }
+    defer rows.Close()
+    spp := make([]ScheduledPost, 0, first)
+    for rows.Next() {
+        var sp ScheduledPost
+        var pollOptions []string
+        var pollDuration *int
+        if err = rows.Scan(&sp.ID, &sp.Content, &sp.SpoilerOf, &sp.NSFW, &sp.QuotedPostID, &sp.InReplyToPostID, pq.Array(&sp.MediaIDs), pq.Array(&pollOptions), &pollDuration, &sp.Visibility, &sp.PublishAt, &sp.Status, &sp.CreatedAt); err != nil {
+            return nil, fmt.Errorf("couldn't scan scheduled post: %v", err)
+        }
+        sp.Poll = scheduledPoll(pollOptions, pollDuration)
+        sp.UserID = uid
+        spp = append(spp, sp)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate scheduled posts rows: %v", err)
+    }
+    return spp, nil
+}
+
+//UpdateScheduledPost replaces a scheduled post of the authenticated user as long as it's not published yet.
+func (s *Service) UpdateScheduledPost(ctx context.Context, scheduledPostID int64, in CreatePostInput, publishAt time.Time) (ScheduledPost, error) {
+    var sp ScheduledPost
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return sp, ErrUnauthenticated
+    }
+    in, err := s.validateScheduledPost(ctx, uid, in, publishAt)
+    if err != nil {
+        return sp, err
+    }
+    query := `
+        UPDATE scheduled_posts SET
+            content = $1, spoiler_of = $2, nsfw = $3, quoted_post_id = $4, in_reply_to_post_id = $5, media_ids = $6,
+            poll_options = $7, poll_duration_minutes = $8, visibility = $9, publish_at = $10
+        WHERE id = $11 AND user_id = $12 AND status = 'scheduled'
+        RETURNING status, created_at`
+    pollOptions, pollDuration := scheduledPollColumns(in.Poll)
+    err = s.db.QueryRowContext(ctx, query, in.Content, in.SpoilerOf, in.NSFW, in.QuotedPostID, in.InReplyToPostID, pq.Array(in.MediaIDs), pollOptions, pollDuration, in.Visibility, publishAt, scheduledPostID, uid).
+        Scan(&sp.Status, &sp.CreatedAt)
+    if err == sql.ErrNoRows {
+        return sp, ErrScheduledPostNotFound
+    }
+    if err != nil {
+        return sp, fmt.Errorf("couldn't update scheduled post: %v", err)
+    }
+    sp.ID = scheduledPostID
+    sp.UserID = uid
+    sp.Content = in.Content
+    sp.SpoilerOf = in.SpoilerOf
+    sp.NSFW = in.NSFW
+    sp.QuotedPostID = in.QuotedPostID
+    sp.InReplyToPostID = in.InReplyToPostID
+    sp.MediaIDs = in.MediaIDs
+    sp.Poll = in.Poll
+    sp.Visibility = in.Visibility
+    sp.PublishAt = publishAt
+    return sp, nil
+}
+
+//CancelScheduledPost deletes a scheduled post of the authenticated user as long as it's not published yet.
+func (s *Service) CancelScheduledPost(ctx context.Context, scheduledPostID int64) error {
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return ErrUnauthenticated
+    }
+    query := "DELETE FROM scheduled_posts WHERE id = $1 AND user_id = $2 AND status = 'scheduled'"
+    result, err := s.db.ExecContext(ctx, query, scheduledPostID, uid)
+    if err != nil {
+        return fmt.Errorf("couldn't delete scheduled post: %v", err)
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return ErrScheduledPostNotFound
+    }
+    return nil
+}
+
+func (s *Service) validateScheduledPost(ctx context.Context, uid int64, in CreatePostInput, publishAt time.Time) (CreatePostInput, error) {
+    in, err := validateCreatePostInput(in)
+    if err != nil {
+        return in, err
+    }
+    if now := time.Now(); !publishAt.After(now) || publishAt.After(now.Add(maxScheduleAhead)) {
+        return in, ErrInvalidPublishAt
+    }
+    if in.QuotedPostID != nil {
+        visible, err := postVisible(ctx, s.db, *in.QuotedPostID, uid, true)
+        if err != nil {
+            return in, err
+        }
+        if !visible {
+            return in, ErrQuotedPostNotFound
+        }
+    }
+    if in.InReplyToPostID != nil {
+        visible, err := postVisible(ctx, s.db, *in.InReplyToPostID, uid, false)
+        if err != nil {
+            return in, err
+        }
+        if !visible {
+            return in, ErrRepliedPostNotFound
+        }
+    }
+    return in, s.checkPendingMedia(ctx, uid, in.MediaIDs)
+}
+
+// scheduledPollColumns flattens the poll so it's stored along the scheduled post.
+// The duration only starts counting once the post gets published.
+func scheduledPollColumns(poll *PollInput) (interface{}, *int) {
+    if poll == nil {
+        return nil, nil
+    }
+    return pq.Array(poll.Options), &poll.DurationMinutes
+}
+
+func scheduledPoll(options []string, durationMinutes *int) *PollInput {
+    if options == nil || durationMinutes == nil {
+        return nil
+    }
+    return &PollInput{Options: options, DurationMinutes: *durationMinutes}
+}
+
+// publishScheduledPosts publishes the due scheduled posts in the background.
+// It first redoes the fanout of the posts published right before the server stopped.
+func (s *Service) publishScheduledPosts(ctx context.Context) {
+    s.redoScheduledPostsFanout(ctx)
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(scheduledPostsInterval):
+            for {
+                published, err := s.publishNextScheduledPost(ctx)
+                if err != nil {
+                    log.Printf("couldn't publish scheduled post: %v\n", err)
+                    break
+                }
+                if !published {
+                    break
+                }
+            }
+        }
+    }
+}
+
+// publishNextScheduledPost publishes the next due scheduled post, if any.
+// The scheduled post row stays locked until the post is created and it's marked as published in the same transaction,
+// so it's published exactly once even with several instances running the worker.
+// Scheduled posts that can't be published anymore are marked as failed so they don't hold the queue.
+func (s *Service) publishNextScheduledPost(ctx context.Context) (bool, error) {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return false, fmt.Errorf("couldn't begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    var sp ScheduledPost
+    query := `
+        SELECT id, user_id, content, spoiler_of, nsfw, quoted_post_id, in_reply_to_post_id, media_ids, poll_options, poll_duration_minutes, visibility FROM scheduled_posts
+        WHERE status = 'scheduled' AND publish_at <= now()
+        ORDER BY publish_at ASC
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED`
+    var pollOptions []string
+    var pollDuration *int
+    err = tx.QueryRowContext(ctx, query).Scan(&sp.ID, &sp.UserID, &sp.Content, &sp.SpoilerOf, &sp.NSFW, &sp.QuotedPostID, &sp.InReplyToPostID, pq.Array(&sp.MediaIDs), pq.Array(&pollOptions), &pollDuration, &sp.Visibility)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("couldn't query select due scheduled post: %v", err)
+    }
+    ti, err := insertPost(ctx, tx, sp.UserID, CreatePostInput{
+        Content:         sp.Content,
+        SpoilerOf:       sp.SpoilerOf,
+        NSFW:            sp.NSFW,
+        QuotedPostID:    sp.QuotedPostID,
+        InReplyToPostID: sp.InReplyToPostID,
+        MediaIDs:        sp.MediaIDs,
+        Poll:            scheduledPoll(pollOptions, pollDuration),
+        Visibility:      sp.Visibility,
+    })
+    if err != nil {
+        tx.Rollback()
+        log.Printf("couldn't publish scheduled post %d: %v\n", sp.ID, err)
+        query = "UPDATE scheduled_posts SET status = $1 WHERE id = $2 AND status = 'scheduled'"
+        if _, err = s.db.ExecContext(ctx, query, scheduledPostStatusFailed, sp.ID); err != nil {
+            return false, fmt.Errorf("couldn't update and mark scheduled post as failed: %v", err)
+        }
+        return true, nil
+    }
+    query = "UPDATE scheduled_posts SET status = $1, post_id = $2, fanout_pending = true WHERE id = $3"
+    if _, err = tx.ExecContext(ctx, query, scheduledPostStatusPublished, ti.Post.ID, sp.ID); err != nil {
+        return false, fmt.Errorf("couldn't update and mark scheduled post as published: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return false, fmt.Errorf("couldn't commit scheduled post publication: %v", err)
+    }
+    if err = s.hydratePosts(ctx, &ti.Post); err != nil {
+        log.Printf("couldn't hydrate published scheduled post: %v\n", err)
+    }
+    s.fanoutScheduledPost(ctx, sp.ID, ti.Post)
+    return true, nil
+}
+
+// fanoutScheduledPost fans out the published post and then clears the pending fanout flag of its scheduled post.
+// The flag is only cleared once the post reached the timelines, so a crash in between gets the fanout redone.
+func (s *Service) fanoutScheduledPost(ctx context.Context, scheduledPostID int64, p Post) {
+    if !s.postCreated(p) {
+        return
+    }
+    query := "UPDATE scheduled_posts SET fanout_pending = false WHERE id = $1"
+    if _, err := s.db.ExecContext(ctx, query, scheduledPostID); err != nil {
+        log.Printf("couldn't update and clear scheduled post fanout: %v\n", err)
+    }
+}
+
+// redoScheduledPostsFanout finishes the fanout of the published scheduled posts a previous run left pending.
+func (s *Service) redoScheduledPostsFanout(ctx context.Context) {
+    query := "UPDATE scheduled_posts SET fanout_pending = false WHERE fanout_pending AND post_id IS NULL"
+    if _, err := s.db.ExecContext(ctx, query); err != nil {
+        log.Printf("couldn't update and clear fanout of deleted scheduled posts: %v\n", err)
+    }
+    for {
+        redone, err := s.redoNextScheduledPostFanout(ctx)
+        if err != nil {
+            log.Printf("couldn't redo scheduled post fanout: %v\n", err)
+            return
+        }
+        if !redone {
+            return
+        }
+    }
+}
+
+// redoNextScheduledPostFanout claims the next scheduled post with a pending fanout and inserts it into the timelines again.
+// Only the timeline insert is redone since it skips the timelines already having the post,
+// notifications and the rest of the side effects aren't unique and would be sent twice.
+// The row stays locked until the flag is cleared so instances starting together don't redo the same post.
+func (s *Service) redoNextScheduledPostFanout(ctx context.Context) (bool, error) {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return false, fmt.Errorf("couldn't begin tx: %v", err)
+    }
+    defer tx.Rollback()
+    query, args, err := buildQuery(`
+        SELECT `+postColumns+`, scheduled_posts.id
+        FROM scheduled_posts
+        INNER JOIN posts ON scheduled_posts.post_id = posts.id
+        `+postJoins+`
+        WHERE scheduled_posts.fanout_pending
+        LIMIT 1
+        FOR UPDATE OF scheduled_posts SKIP LOCKED`, map[string]interface{}{
+        "auth": false,
+    })
+    if err != nil {
+        return false, fmt.Errorf("couldn't build pending scheduled post fanout sql query: %v", err)
+    }
+    var scheduledPostID int64
+    p, err := s.scanPost(tx.QueryRowContext(ctx, query, args...), false, &scheduledPostID)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("couldn't query select pending scheduled post fanout: %v", err)
+    }
+    if err = s.hydratePosts(ctx, &p); err != nil {
+        return false, err
+    }
+    if !s.fanoutPost(p, nil) {
+        return false, fmt.Errorf("couldn't fan out scheduled post %d", scheduledPostID)
+    }
+    query = "UPDATE scheduled_posts SET fanout_pending = false WHERE id = $1"
+    if _, err = tx.ExecContext(ctx, query, scheduledPostID); err != nil {
+        return false, fmt.Errorf("couldn't update and clear scheduled post fanout: %v", err)
+    }
+    if err = tx.Commit(); err != nil {
+        return false, fmt.Errorf("couldn't commit scheduled post fanout: %v", err)
+    }
+    return true, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+)
+
+const (
+    //SearchSortRelevance ranks the search results by how well they match the query.
+    SearchSortRelevance = "relevance"
+    //SearchSortRecent orders the search results by creation, newest first.
+    SearchSortRecent = "recent"
+
+    searchDateLayout = "2006-01-02"
+)
+
+var (
+    //ErrInvalidSearchQuery is used to indicate that the search query is empty or has malformed operators.
+    ErrInvalidSearchQuery = errors.New("invalid search query")
+    //ErrInvalidSearchSort is used to indicate that the search sort isn't one of relevance or recent.
+    ErrInvalidSearchSort = errors.New("search sort must be one of relevance or recent")
+)
+
+// searchQuery is a parsed search query. The text is left as is for websearch_to_tsquery,
+// which already understands "quoted phrases", OR and -excluded words.
+type searchQuery struct {
+    text     string
+    from     string
+    hasMedia bool
+    safe     bool
+    since    *time.Time
+    until    *time.Time
+}
+
+// parseSearchQuery extracts the from:username, has:media, -nsfw, since:YYYY-MM-DD and until:YYYY-MM-DD operators.
+func parseSearchQuery(q string) (searchQuery, error) {
+    var sq searchQuery
+    words := []string{}
+    for _, word := range strings.Fields(q) {
+        lower := strings.ToLower(word)
+        switch {
+        case strings.HasPrefix(lower, "from:"):
+            sq.from = strings.TrimPrefix(word[len("from:"):], "@")
+            if !rxUsername.MatchString(sq.from) {
+                return sq, ErrInvalidSearchQuery
+            }
+        case lower == "has:media":
+            sq.hasMedia = true
+        case lower == "-nsfw":
+            sq.safe = true
+        case strings.HasPrefix(lower, "since:"):
+            t, err := time.Parse(searchDateLayout, word[len("since:"):])
+            if err != nil {
+                return sq, ErrInvalidSearchQuery
+            }
+            sq.since = &t
+        case strings.HasPrefix(lower, "until:"):
+            t, err := time.Parse(searchDateLayout, word[len("until:"):])
+            if err != nil {
+                return sq, ErrInvalidSearchQuery
+            }
+            // until is inclusive.
+            t = t.AddDate(0, 0, 1)
+            sq.until = &t
+        default:
+            words = append(words, word)
+        }
+    }
+    sq.text = strings.Join(words, " ")
+    if sq.text == "" && sq.from == "" {
+        return sq, ErrInvalidSearchQuery
+    }
+    return sq, nil
+}
+
+//SearchPosts does a full-text search over the posts content with backward pagination.
+//Results are ranked by relevance, or by recency when sort is recent.
+func (s *Service) SearchPosts(ctx context.Context, q, sort string, last int, before int64) ([]Post, error) {
+    sq, err := parseSearchQuery(q)
+    if err != nil {
+        return nil, err
+    }
+    if sort == "" {
+        sort = SearchSortRelevance
+    }
+    if sort != SearchSortRelevance && sort != SearchSortRecent {
+        return nil, ErrInvalidSearchSort
+    }
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    last = normalizePageSize(last)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
+    query, args, err := buildQuery(`
+        SELECT `+postColumns+`
+        FROM posts
+        `+postJoins+`
+        WHERE posts.visibility != 'unlisted' AND `+visibleTo("@uid")+`
+        {{if .text}} AND to_tsvector('english', content) @@ websearch_to_tsquery('english', @text){{end}}
+        {{if .from}} AND users.username = @from{{end}}
+        {{if .has_media}} AND EXISTS (SELECT 1 FROM media WHERE media.post_id = posts.id){{end}}
+        {{if .safe}} AND NOT posts.nsfw{{end}}
+        `+postNSFWFilter+`
+        {{if .since}} AND posts.created_at >= @since{{end}}
+        {{if .until}} AND posts.created_at < @until{{end}}
+        {{if .before}}
+            {{if .relevance}}
+            AND (ts_rank(to_tsvector('english', content), websearch_to_tsquery('english', @text)), posts.id) < (
+                SELECT ts_rank(to_tsvector('english', content), websearch_to_tsquery('english', @text)), id
+                FROM posts WHERE id = @before
+            )
+            {{else}}
+            AND posts.id < @before
+            {{end}}
+        {{end}}
+        ORDER BY
+        {{if .relevance}}ts_rank(to_tsvector('english', content), websearch_to_tsquery('english', @text)) DESC,{{end}}
+        posts.id DESC
+        LIMIT @last
+    `, map[string]interface{}{
+        "auth":      auth,
+        "uid":       uid,
+        "text":      sq.text,
+        "from":      sq.from,
+        "has_media": sq.hasMedia,
+        "safe":      sq.safe,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
+        "since":     sq.since,
+        "until":     sq.until,
+        "relevance": sort == SearchSortRelevance && sq.text != "",
+        "last":      last,
+        "before":    before,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("couldn't build search posts query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query search posts: %v", err)
+    }
+    defer rows.Close()
+    pp := make([]Post, 0, last)
+    for rows.Next() {
+        p, err := s.scanPost(rows, auth)
+        if err != nil {
+            return nil, fmt.Errorf("couldn't scan searched post: %v", err)
+        }
+        pp = append(pp, p)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate searched posts rows: %v", err)
+    }
+    if err = s.hydratePosts(ctx, postPtrs(pp)...); err != nil {
+        return nil, err
+    }
+    prefs.apply(postPtrs(pp)...)
+    return pp, nil
+}
@@ -4,10 +4,12 @@ import (
     "context"
     "database/sql"
     "net"
+    "net/http"
     "net/smtp"
     "net/url"
     "strconv"
     "sync"
+    "time"
 
     "github.com/hako/branca"
 )
@@ -23,6 +25,17 @@ type Service struct {
     timelineItemClients sync.Map
     commentClients      sync.Map
     notificationClients sync.Map
+    postEditWindow      time.Duration
+    linkPreviewClient   *http.Client
+
+    countersReconciliationMu   sync.Mutex
+    lastCountersReconciliation *CountersReconciliation
+
+    trendsMu sync.Mutex
+    trends   map[string]Trends
+
+    postEngagementsMu sync.Mutex
+    postEngagements   map[postEngagement]time.Time
 }
 
 // Config to create a new service.
@@ -34,6 +47,16 @@ type Config struct {
     SMTPPort     int
     SMTPUsername string
     SMTPPassword string
+    // CountersReconciliationInterval between the background counters reconciliations, defaults to 6 hours.
+    CountersReconciliationInterval time.Duration
+    // CountersReconciliationSample is how many random rows per table each reconciliation checks, zero scans them all.
+    CountersReconciliationSample int
+    // PostEditWindow is for how long after creation a post can be edited, defaults to 30 minutes.
+    PostEditWindow time.Duration
+    // TrendsInterval between the background trends computations, defaults to 5 minutes.
+    TrendsInterval time.Duration
+    // DisableWorkers doesn't start the background workers, for one-off commands.
+    DisableWorkers bool
 }
 
 // New is used to instantiate the service.
@@ -41,14 +64,37 @@ func New(cfg Config) *Service {
     codec := branca.NewBranca(cfg.SecretKey)
     codec.SetTTL(uint32(tokenTTL.Seconds()))
     originURL, _ := url.Parse(cfg.Origin)
+    if cfg.PostEditWindow <= 0 {
+        cfg.PostEditWindow = defaultPostEditWindow
+    }
+    if cfg.CountersReconciliationInterval <= 0 {
+        cfg.CountersReconciliationInterval = defaultCountersReconciliationInterval
+    }
+    if cfg.TrendsInterval <= 0 {
+        cfg.TrendsInterval = defaultTrendsInterval
+    }
     s := &Service{
-        db:       cfg.DB,
-        codec:    codec,
-        origin:   cfg.Origin,
-        noReply:  "noreply@" + originURL.Hostname(),
-        smtpAddr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
-        smtpAuth: smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost),
+        db:                cfg.DB,
+        codec:             codec,
+        origin:            cfg.Origin,
+        noReply:           "noreply@" + originURL.Hostname(),
+        smtpAddr:          net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+        smtpAuth:          smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost),
+        postEditWindow:    cfg.PostEditWindow,
+        linkPreviewClient: newLinkPreviewClient(linkPreviewTimeout, publicAddressOnly),
+        trends:            map[string]Trends{},
+        postEngagements:   map[postEngagement]time.Time{},
+    }
+    if cfg.DisableWorkers {
+        return s
     }
     go s.deleteExpiredVerificationCodes(context.Background())
+    go s.deleteUnattachedMedia(context.Background())
+    go s.resumeFollowImports(context.Background())
+    go s.reconcileCountersPeriodically(context.Background(), cfg.CountersReconciliationInterval, cfg.CountersReconciliationSample)
+    go s.computeTrendsPeriodically(context.Background(), cfg.TrendsInterval)
+    go s.publishScheduledPosts(context.Background())
+    go s.endPolls(context.Background())
+    go s.flushPostEngagements(context.Background())
     return s
 }
@@ -0,0 +1,143 @@
+package service
+
+import (
+    "context"
+    "fmt"
+)
+
+// maxThreadDepth is how deep the descendants tree of a thread goes.
+const maxThreadDepth = 10
+
+// Thread is a post along with the posts it replies to and the tree of its replies.
+type Thread struct {
+    Ancestors []Post         `json:"ancestors"`
+    Post      Post           `json:"post"`
+    Replies   []*ThreadReply `json:"replies"`
+}
+
+// ThreadReply is a node of the thread replies tree.
+type ThreadReply struct {
+    Post
+    Replies []*ThreadReply `json:"replies"`
+}
+
+//Thread of a post, its ancestors from the conversation root down and its replies tree
+//with forward pagination over the direct replies.
+func (s *Service) Thread(ctx context.Context, postID int64, first int, after int64) (Thread, error) {
+    var t Thread
+    p, err := s.Post(ctx, postID)
+    if err != nil {
+        return t, err
+    }
+    t.Post = p
+    uid, auth := ctx.Value(KeyAuthUserID).(int64)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return t, err
+    }
+    query, args, err := buildQuery(`
+        WITH RECURSIVE ancestors AS (
+            SELECT in_reply_to_post_id AS id, 1 AS depth FROM posts WHERE id = @post_id
+            UNION ALL
+            SELECT posts.in_reply_to_post_id, ancestors.depth + 1
+            FROM posts INNER JOIN ancestors ON posts.id = ancestors.id
+        )
+        `+threadPostsQuery+`
+        INNER JOIN ancestors ON posts.id = ancestors.id
+        WHERE `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
+        ORDER BY ancestors.depth DESC
+    `, map[string]interface{}{
+        "auth":      auth,
+        "uid":       uid,
+        "post_id":   postID,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
+    })
+    if err != nil {
+        return t, fmt.Errorf("couldn't build thread ancestors query: %v", err)
+    }
+    if t.Ancestors, err = s.threadPosts(ctx, query, args, auth, prefs); err != nil {
+        return t, err
+    }
+
+    first = normalizePageSize(first)
+    query, args, err = buildQuery(`
+        WITH RECURSIVE replies AS (
+            (
+                SELECT id, 1 AS depth FROM posts
+                WHERE in_reply_to_post_id = @post_id
+                {{if .after}} AND id > @after{{end}}
+                ORDER BY id ASC
+                LIMIT @first
+            )
+            UNION ALL
+            SELECT posts.id, replies.depth + 1
+            FROM posts INNER JOIN replies ON posts.in_reply_to_post_id = replies.id
+            WHERE replies.depth < @max_depth
+        )
+        `+threadPostsQuery+`
+        INNER JOIN replies ON posts.id = replies.id
+        WHERE `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
+        ORDER BY posts.id ASC
+    `, map[string]interface{}{
+        "auth":      auth,
+        "uid":       uid,
+        "post_id":   postID,
+        "first":     first,
+        "after":     after,
+        "max_depth": maxThreadDepth,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
+    })
+    if err != nil {
+        return t, fmt.Errorf("couldn't build thread replies query: %v", err)
+    }
+    pp, err := s.threadPosts(ctx, query, args, auth, prefs)
+    if err != nil {
+        return t, err
+    }
+    // replies always come after the post they reply to, so every parent is already in the tree.
+    t.Replies = []*ThreadReply{}
+    nodes := map[int64]*ThreadReply{}
+    for _, p := range pp {
+        r := &ThreadReply{Post: p, Replies: []*ThreadReply{}}
+        nodes[p.ID] = r
+        if *p.InReplyToPostID == postID {
+            t.Replies = append(t.Replies, r)
+            continue
+        }
+        if parent, ok := nodes[*p.InReplyToPostID]; ok {
+            parent.Replies = append(parent.Replies, r)
+        }
+    }
+    return t, nil
+}
+
+const threadPostsQuery = `
+    SELECT ` + postColumns + `
+    FROM posts
+    ` + postJoins
+
+func (s *Service) threadPosts(ctx context.Context, query string, args []interface{}, auth bool, prefs ContentPreferences) ([]Post, error) {
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("couldn't query select thread posts: %v", err)
+    }
+    defer rows.Close()
+    pp := []Post{}
+    for rows.Next() {
+        p, err := s.scanPost(rows, auth)
+        if err != nil {
+            return nil, fmt.Errorf("couldn't scan thread post: %v", err)
+        }
+        pp = append(pp, p)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("couldn't iterate thread posts rows: %v", err)
+    }
+    if err = s.hydratePosts(ctx, postPtrs(pp)...); err != nil {
+        return nil, err
+    }
+    prefs.apply(postPtrs(pp)...)
+    return pp, nil
+}
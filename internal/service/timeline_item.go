@@ -6,17 +6,32 @@ import (
     "fmt"
 )
 
+const (
+    // TimelineItemEventCreated is pushed to timeline subscribers when a new post reaches their timeline.
+    TimelineItemEventCreated = "created"
+    // TimelineItemEventUpdated is pushed to timeline subscribers when a post they received gets edited.
+    TimelineItemEventUpdated = "updated"
+    // TimelineItemEventDeleted is pushed to timeline subscribers when a post they received gets deleted.
+    TimelineItemEventDeleted = "deleted"
+)
+
 //TimelineItem model.
 type TimelineItem struct {
-    ID     int64 `json:"id"`
-    UserID int64 `json:"-"`
-    PostID int64 `json:"-"`
-    Post   Post  `json:"post"`
-    User   *User `json:"user,omitempty"`
+    ID     int64  `json:"id"`
+    UserID int64  `json:"-"`
+    PostID int64  `json:"-"`
+    ListID int64  `json:"-"` // set when the item is pushed to a list timeline.
+    Post   Post   `json:"post"`
+    User   *User  `json:"user,omitempty"`
+    Event  string `json:"event,omitempty"` // only set on items pushed to subscribers.
+    // RepostedBy is set when the post reached the timeline through a repost.
+    RepostedBy *User `json:"reposted_by,omitempty"`
 }
 type timelineItemClient struct {
     timeline chan TimelineItem
     userID   int64
+    listID   int64
+    prefs    ContentPreferences
 }
 
 //Timeline is used to show the timeline of the authenticated user.
@@ -26,27 +41,28 @@ func (s *Service) Timeline(ctx context.Context, last int, before int64) ([]Timel
         return nil, ErrUnauthenticated
     }
     last = normalizePageSize(last)
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
     query, args, err := buildQuery(`
-        SELECT timeline.id, posts.id, content, spoiler_of, nsfw, likes_count, created_at, comments_count
-        , posts.user_id = @uid AS mine
-        , likes.user_id IS NOT NULL AS liked
-        , subscriptions.user_id IS NOT NULL AS subscribed
-        , users.username, users.avatar
+        SELECT `+postColumns+`
+        , timeline.id, reposters.username, reposters.avatar
         FROM timeline
-        INNER JOIN posts on timeline.post_id = posts.id
-        INNER JOIN users on posts.user_id = users.id
-        LEFT JOIN post_likes AS likes
-        ON likes.user_id = @uid AND likes.post_id = posts.id
-        LEFT JOIN post_subscriptions AS subscriptions
-            ON subscriptions.user_id = @uid AND subscriptions.post_id = posts.id
-        WHERE timeline.user_id = @uid
-        {{if .before}} AND posts.id < @before{{end}}
-        ORDER BY created_at DESC
+        INNER JOIN posts ON timeline.post_id = posts.id
+        `+postJoins+`
+        LEFT JOIN users AS reposters ON timeline.reposted_by_id = reposters.id
+        WHERE timeline.user_id = @uid AND `+visibleTo("@uid")+`
+        `+postNSFWFilter+`
+        {{if .before}} AND timeline.id < @before{{end}}
+        ORDER BY timeline.id DESC
         LIMIT @last
     `, map[string]interface{}{
-        "uid":    uid,
-        "last":   last,
-        "before": before,
+        "auth":      true,
+        "uid":       uid,
+        "last":      last,
+        "before":    before,
+        "hide_nsfw": prefs.NSFW == NSFWHide,
     })
     if err != nil {
         return nil, fmt.Errorf("Couldn't build timeline query: %v", err)
@@ -59,37 +75,34 @@ func (s *Service) Timeline(ctx context.Context, last int, before int64) ([]Timel
     tt := make([]TimelineItem, 0, last)
     for rows.Next() {
         var ti TimelineItem
-        var u User
-        var avatar sql.NullString
-        dest := []interface{}{
-            &ti.ID,
-            &ti.Post.ID,
-            &ti.Post.Content,
-            &ti.Post.SpoilerOf,
-            &ti.Post.NSFW,
-            &ti.Post.LikesCount,
-            &ti.Post.CreatedAt,
-            &ti.Post.Mine,
-            &ti.Post.Liked,
-            &ti.Post.Subscribed,
-            &u.Username,
-            &avatar,
-            &ti.Post.CommentsCount,
-        }
-        if err = rows.Scan(dest...); err != nil {
+        var reposterUsername, reposterAvatar sql.NullString
+        ti.Post, err = s.scanPost(rows, true, &ti.ID, &reposterUsername, &reposterAvatar)
+        if err != nil {
             return nil, fmt.Errorf("couldn't scan post: %v", err)
         }
-        if avatar.Valid {
-            avatarURL := s.origin + "/avatars/users/" + avatar.String
-            u.AvatarURL = &avatarURL
+        if reposterUsername.Valid {
+            ti.RepostedBy = &User{Username: reposterUsername.String}
+            if reposterAvatar.Valid {
+                avatarURL := s.origin + "/avatars/users/" + reposterAvatar.String
+                ti.RepostedBy.AvatarURL = &avatarURL
+            }
         }
-        ti.Post.User = &u
         tt = append(tt, ti)
     }
     if err = rows.Err(); err != nil {
         return nil, fmt.Errorf("couldn't iterate posts rows: %v", err)
     }
-
+    pp := make([]*Post, len(tt))
+    postIDs := make([]int64, len(tt))
+    for i := range tt {
+        pp[i] = &tt[i].Post
+        postIDs[i] = tt[i].Post.ID
+    }
+    if err = s.hydratePosts(ctx, pp...); err != nil {
+        return nil, err
+    }
+    prefs.apply(pp...)
+    s.recordImpressions(ctx, postIDs...)
     return tt, nil
 }
 func (s *Service) SubscribeToTimeline(ctx context.Context) (chan TimelineItem, error) {
@@ -97,8 +110,12 @@ func (s *Service) SubscribeToTimeline(ctx context.Context) (chan TimelineItem, e
     if !ok {
         return nil, ErrUnauthenticated
     }
+    prefs, err := s.contentPreferences(ctx)
+    if err != nil {
+        return nil, err
+    }
     tt := make(chan TimelineItem)
-    c := &timelineItemClient{timeline: tt, userID: uid}
+    c := &timelineItemClient{timeline: tt, userID: uid, prefs: prefs}
     s.timelineItemClients.Store(c, struct{}{})
     go func() {
         <-ctx.Done()
@@ -110,7 +127,10 @@ func (s *Service) SubscribeToTimeline(ctx context.Context) (chan TimelineItem, e
 func (s *Service) broadcastTimelineItem(ti TimelineItem) {
     s.timelineItemClients.Range(func(key, _ interface{}) bool {
         client := key.(*timelineItemClient)
-        if client.userID == ti.UserID {
+        if client.listID != ti.ListID || (ti.ListID == 0 && client.userID != ti.UserID) {
+            return true
+        }
+        if ti, ok := client.prefs.applyToTimelineItem(ti, client.userID); ok {
             client.timeline <- ti
         }
         return true
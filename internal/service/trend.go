@@ -0,0 +1,226 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+const (
+    defaultTrendsInterval = time.Minute * 5
+    trendsLimit           = 20
+    minTrendUses          = 3
+    maxPostPhrases        = 20
+)
+
+var (
+    rxPhraseBreak = regexp.MustCompile(`[.,;:!?()\[\]{}"\n]+`)
+    rxWord        = regexp.MustCompile(`[\p{L}\p{N}']+`)
+)
+
+var phraseStopwords = map[string]struct{}{
+    "a": {}, "an": {}, "and": {}, "are": {}, "as": {}, "at": {}, "be": {}, "but": {}, "by": {}, "for": {},
+    "from": {}, "has": {}, "have": {}, "i": {}, "in": {}, "is": {}, "it": {}, "its": {}, "it's": {}, "me": {},
+    "my": {}, "of": {}, "on": {}, "or": {}, "so": {}, "that": {}, "the": {}, "this": {}, "to": {}, "was": {},
+    "we": {}, "were": {}, "what": {}, "with": {}, "you": {}, "your": {},
+}
+
+// trendWindow is a sliding window trends are computed over,
+// compared against the usage of the preceding baseline period.
+type trendWindow struct {
+    name     string
+    window   time.Duration
+    baseline time.Duration
+}
+
+var trendWindows = []trendWindow{
+    {"1h", time.Hour, time.Hour * 24},
+    {"24h", time.Hour * 24, time.Hour * 24 * 7},
+}
+
+var (
+    //ErrInvalidTrendsWindow is used to indicate that the trends window isn't one of 1h or 24h.
+    ErrInvalidTrendsWindow = errors.New("trends window must be one of 1h or 24h")
+)
+
+// Trend is a trending hashtag or phrase.
+type Trend struct {
+    Term  string  `json:"term"`
+    Kind  string  `json:"kind"`
+    Uses  int     `json:"uses"`
+    Score float64 `json:"score"`
+}
+
+// Trends of a window.
+type Trends struct {
+    Window     string    `json:"window"`
+    ComputedAt time.Time `json:"computed_at"`
+    Trends     []Trend   `json:"trends"`
+}
+
+//Trends returns the trending hashtags and phrases of the window.
+//When following is set, only what the authenticated user followees are posting is taken into account.
+func (s *Service) Trends(ctx context.Context, window string, following bool) (Trends, error) {
+    if window == "" {
+        window = trendWindows[0].name
+    }
+    var tw *trendWindow
+    for i := range trendWindows {
+        if trendWindows[i].name == window {
+            tw = &trendWindows[i]
+        }
+    }
+    if tw == nil {
+        return Trends{}, ErrInvalidTrendsWindow
+    }
+    if !following {
+        s.trendsMu.Lock()
+        t, ok := s.trends[window]
+        s.trendsMu.Unlock()
+        if ok {
+            return t, nil
+        }
+        return s.computeTrends(ctx, *tw, 0)
+    }
+    uid, ok := ctx.Value(KeyAuthUserID).(int64)
+    if !ok {
+        return Trends{}, ErrUnauthenticated
+    }
+    return s.computeTrends(ctx, *tw, uid)
+}
+
+// computeTrends scores the hashtags and phrases used by at least minTrendUses distinct users in the window
+// by how far their usage goes above what the baseline period predicts.
+// When uid is set only the posts of the user followees are counted.
+func (s *Service) computeTrends(ctx context.Context, tw trendWindow, uid int64) (Trends, error) {
+    t := Trends{Window: tw.name, ComputedAt: time.Now(), Trends: []Trend{}}
+    query, args, err := buildQuery(`
+        WITH terms AS (
+            SELECT '#' || hashtags.name AS term, 'hashtag' AS kind, posts.user_id, posts.created_at
+            FROM post_hashtags
+            INNER JOIN hashtags ON post_hashtags.hashtag_id = hashtags.id
+            INNER JOIN posts ON post_hashtags.post_id = posts.id
+            WHERE posts.visibility = 'public' AND posts.created_at >= now() - INTERVAL '1 second' * @baseline
+            UNION ALL
+            SELECT phrase, 'phrase', posts.user_id, posts.created_at
+            FROM post_phrases
+            INNER JOIN posts ON post_phrases.post_id = posts.id
+            WHERE posts.visibility = 'public' AND posts.created_at >= now() - INTERVAL '1 second' * @baseline
+        ), counts AS (
+            SELECT term, kind
+                , count(DISTINCT user_id) FILTER (WHERE created_at >= now() - INTERVAL '1 second' * @window) AS uses
+                , count(DISTINCT user_id) FILTER (WHERE created_at < now() - INTERVAL '1 second' * @window) * @ratio::float8 AS expected
+            FROM terms
+            {{if .uid}}WHERE user_id IN (SELECT followee_id FROM follows WHERE follower_id = @uid){{end}}
+            GROUP BY term, kind
+        )
+        SELECT term, kind, uses, (uses - expected) / sqrt(expected + 1) AS score
+        FROM counts
+        WHERE uses >= @min_uses
+        ORDER BY score DESC, uses DESC
+        LIMIT @limit
+    `, map[string]interface{}{
+        "baseline": int((tw.window + tw.baseline).Seconds()),
+        "window":   int(tw.window.Seconds()),
+        "ratio":    tw.window.Seconds() / tw.baseline.Seconds(),
+        "uid":      uid,
+        "min_uses": minTrendUses,
+        "limit":    trendsLimit,
+    })
+    if err != nil {
+        return t, fmt.Errorf("couldn't build trends query: %v", err)
+    }
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return t, fmt.Errorf("couldn't query select trends: %v", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var tr Trend
+        if err = rows.Scan(&tr.Term, &tr.Kind, &tr.Uses, &tr.Score); err != nil {
+            return t, fmt.Errorf("couldn't scan trend: %v", err)
+        }
+        t.Trends = append(t.Trends, tr)
+    }
+    if err = rows.Err(); err != nil {
+        return t, fmt.Errorf("couldn't iterate trends rows: %v", err)
+    }
+    return t, nil
+}
+
+func (s *Service) computeTrendsPeriodically(ctx context.Context, interval time.Duration) {
+    for {
+        for _, tw := range trendWindows {
+            t, err := s.computeTrends(ctx, tw, 0)
+            if err != nil {
+                log.Printf("couldn't compute %s trends: %v\n", tw.name, err)
+                continue
+            }
+            s.trendsMu.Lock()
+            s.trends[tw.name] = t
+            s.trendsMu.Unlock()
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(interval):
+        }
+    }
+}
+
+// collectPhrases returns the distinct two words phrases of the given text,
+// leaving out links, mentions, hashtags and stopwords.
+func collectPhrases(s string) []string {
+    s = rxURL.ReplaceAllString(s, ".")
+    s = rxMentions.ReplaceAllString(s, ".")
+    s = rxHashtags.ReplaceAllString(s, ".")
+    m := map[string]struct{}{}
+    pp := []string{}
+    for _, sentence := range rxPhraseBreak.Split(strings.ToLower(s), -1) {
+        words := rxWord.FindAllString(sentence, -1)
+        for i := 0; i+1 < len(words); i++ {
+            _, stop1 := phraseStopwords[words[i]]
+            _, stop2 := phraseStopwords[words[i+1]]
+            if stop1 || stop2 {
+                continue
+            }
+            phrase := words[i] + " " + words[i+1]
+            if _, ok := m[phrase]; ok {
+                continue
+            }
+            m[phrase] = struct{}{}
+            pp = append(pp, phrase)
+            if len(pp) == maxPostPhrases {
+                return pp
+            }
+        }
+    }
+    return pp
+}
+
+// linkPhrases stores the phrases of the post content for trends.
+func linkPhrases(ctx context.Context, tx *sql.Tx, postID int64, content string) error {
+    phrases := collectPhrases(content)
+    if len(phrases) == 0 {
+        return nil
+    }
+    query := "INSERT INTO post_phrases (post_id, phrase) SELECT $1, unnest($2::varchar[])"
+    if _, err := tx.ExecContext(ctx, query, postID, pq.Array(phrases)); err != nil {
+        return fmt.Errorf("couldn't insert post phrases: %v", err)
+    }
+    return nil
+}
+
+func unlinkPhrases(ctx context.Context, tx *sql.Tx, postID int64) error {
+    if _, err := tx.ExecContext(ctx, "DELETE FROM post_phrases WHERE post_id = $1", postID); err != nil {
+        return fmt.Errorf("couldn't delete post phrases: %v", err)
+    }
+    return nil
+}
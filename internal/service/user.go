@@ -14,6 +14,7 @@ import (
     "path"
     "regexp"
     "strings"
+    "time"
 
     "github.com/disintegration/imaging"
     gonanoid "github.com/matoous/go-nanoid"
@@ -41,6 +42,15 @@ var (
     ErrForbiddenFollow = errors.New("You can not follow yourself")
     //ErrUnsupportedAvatarFormat is used to indicate that uploaded avatar has invalid format.
     ErrUnsupportedAvatarFormat = errors.New("only png and jpeg are allowed as avatars format")
+    //ErrInvalidFollowsSort is used to indicate that followers/followees sort isn't supported.
+    ErrInvalidFollowsSort = errors.New("invalid sort, use recent or alphabetical")
+)
+
+const (
+    // FollowsSortAlphabetical sorts followers/followees by username.
+    FollowsSortAlphabetical = "alphabetical"
+    // FollowsSortRecent sorts followers/followees by the most recent follow.
+    FollowsSortRecent = "recent"
 )
 
 //MaxAvatarBytes to read
@@ -55,12 +65,18 @@ type User struct {
 // UserProfile model.
 type UserProfile struct {
     User
-    Email          string `json:"email,omitempty"`
-    FollowersCount int    `json:"followers_count"`
-    FolloweesCount int    `json:"followees_count"`
-    Me             bool   `json:"me"`
-    Following      bool   `json:"following"`
-    Followeed      bool   `json:"followeed"`
+    Email           string     `json:"email,omitempty"`
+    FollowersCount  int        `json:"followers_count"`
+    FolloweesCount  int        `json:"followees_count"`
+    PostsCount      int        `json:"posts_count"`
+    LikesGivenCount int        `json:"likes_given_count"`
+    CommentsCount   int        `json:"comments_count"`
+    Me              bool       `json:"me"`
+    Following       bool       `json:"following"`
+    Followeed       bool       `json:"followeed"`
+    FollowedAt      *time.Time `json:"followed_at,omitempty"` // only set when listing followers or followees.
+    LikedAt         *time.Time `json:"liked_at,omitempty"`    // only set when listing likers.
+    PinnedPost      *Post      `json:"pinned_post,omitempty"`
 }
 
 //ToggleFollowResponse is used to show the response of toggling a follow of a user.
@@ -158,8 +174,9 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
     uid, auth := ctx.Value(KeyAuthUserID).(int64)
     args := []interface{}{username}
     var avatar sql.NullString
-    dest := []interface{}{&u.ID, &u.Email, &avatar, &u.FollowersCount, &u.FolloweesCount}
-    query := "SELECT id, email, followers_count, followees_count "
+    var pinnedPostID sql.NullInt64
+    dest := []interface{}{&u.ID, &u.Email, &avatar, &u.FollowersCount, &u.FolloweesCount, &u.PostsCount, &u.LikesGivenCount, &u.CommentsCount, &pinnedPostID}
+    query := "SELECT id, email, avatar, followers_count, followees_count, posts_count, likes_given_count, comments_count, pinned_post_id "
     if auth {
         query += ", " +
             "followers.follower_id IS NOT NULL AS following, " +
@@ -169,7 +186,7 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
     query += "FROM users "
     if auth {
         query += "LEFT JOIN follows as followers on followers.follower_id = $2 AND followers.followee_id = users.id " +
-            "LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = $2"
+            "LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = $2 "
         args = append(args, uid)
 
     }
@@ -193,6 +210,15 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
         avatarURL := s.origin + "/avatars/users/" + avatar.String
         u.AvatarURL = &avatarURL
     }
+    if pinnedPostID.Valid {
+        p, err := s.viewablePost(ctx, pinnedPostID.Int64)
+        if err != nil && err != ErrPostNotFound {
+            return u, fmt.Errorf("Couldn't select user pinned post: %v", err)
+        }
+        if err == nil {
+            u.PinnedPost = &p
+        }
+    }
     return u, nil
 }
 
@@ -229,32 +255,12 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
         return response, fmt.Errorf("Couldn't query select exists due to: %v", err)
     }
     if response.Following {
-        query = "DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2"
-        if _, err = tx.ExecContext(ctx, query, followerID, followeeID); err != nil {
-            return response, fmt.Errorf("Couldn't delete follow: %v", err)
-        }
-        query = "UPDATE users SET followees_count = followees_count - 1 WHERE id = $1"
-        if _, err = tx.ExecContext(ctx, query, followerID); err != nil {
-            return response, fmt.Errorf("Couldn't update follower followees_count: %v", err)
-        }
-        query = "UPDATE users SET followers_count = followers_count - 1 WHERE id = $1 RETURNING followers_count"
-        if err = tx.QueryRowContext(ctx, query, followeeID).Scan(&response.FollowersCount); err != nil {
-            return response, fmt.Errorf("Couldn't update followee followers count: %v", err)
-        }
+        response.FollowersCount, err = deleteFollow(ctx, tx, followerID, followeeID)
     } else {
-        query = "INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)"
-        if _, err = tx.ExecContext(ctx, query, followerID, followeeID); err != nil {
-            return response, fmt.Errorf("Couldn't insert follow: %v", err)
-        }
-        query = "UPDATE users SET followees_count = followees_count + 1 where id = $1"
-        if _, err = tx.ExecContext(ctx, query, followerID); err != nil {
-            return response, fmt.Errorf("couldn't update follower followees count: %v", err)
-        }
-        query = "UPDATE users SET followers_count = followers_count + 1 where id = $1 RETURNING followers_count"
-        if err = tx.QueryRowContext(ctx, query, followeeID).Scan(&response.FollowersCount); err != nil {
-            return response, fmt.Errorf("Couldn't update followee followers count: %v", err)
-        }
-
+        response.FollowersCount, err = insertFollow(ctx, tx, followerID, followeeID)
+    }
+    if err != nil {
+        return response, err
     }
     if err = tx.Commit(); err != nil {
         return response, fmt.Errorf("Couldnt commit toggle follow: %v", err)
@@ -266,6 +272,42 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
     return response, nil
 }
 
+// insertFollow inserts the follow and increments both users counters, returning the followee followers count.
+func insertFollow(ctx context.Context, tx *sql.Tx, followerID, followeeID int64) (int, error) {
+    var followersCount int
+    query := "INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)"
+    if _, err := tx.ExecContext(ctx, query, followerID, followeeID); err != nil {
+        return 0, fmt.Errorf("Couldn't insert follow: %v", err)
+    }
+    query = "UPDATE users SET followees_count = followees_count + 1 where id = $1"
+    if _, err := tx.ExecContext(ctx, query, followerID); err != nil {
+        return 0, fmt.Errorf("couldn't update follower followees count: %v", err)
+    }
+    query = "UPDATE users SET followers_count = followers_count + 1 where id = $1 RETURNING followers_count"
+    if err := tx.QueryRowContext(ctx, query, followeeID).Scan(&followersCount); err != nil {
+        return 0, fmt.Errorf("Couldn't update followee followers count: %v", err)
+    }
+    return followersCount, nil
+}
+
+// deleteFollow deletes the follow and decrements both users counters, returning the followee followers count.
+func deleteFollow(ctx context.Context, tx *sql.Tx, followerID, followeeID int64) (int, error) {
+    var followersCount int
+    query := "DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2"
+    if _, err := tx.ExecContext(ctx, query, followerID, followeeID); err != nil {
+        return 0, fmt.Errorf("Couldn't delete follow: %v", err)
+    }
+    query = "UPDATE users SET followees_count = followees_count - 1 WHERE id = $1"
+    if _, err := tx.ExecContext(ctx, query, followerID); err != nil {
+        return 0, fmt.Errorf("Couldn't update follower followees_count: %v", err)
+    }
+    query = "UPDATE users SET followers_count = followers_count - 1 WHERE id = $1 RETURNING followers_count"
+    if err := tx.QueryRowContext(ctx, query, followeeID).Scan(&followersCount); err != nil {
+        return 0, fmt.Errorf("Couldn't update followee followers count: %v", err)
+    }
+    return followersCount, nil
+}
+
 //Users in asc order with forward pagination, and filtered by username
 func (s *Service) Users(ctx context.Context, search string, first int, after string) ([]UserProfile, error) {
     search = strings.TrimSpace(search)
@@ -273,7 +315,7 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
     first = normalizePageSize(first)
     uid, auth := ctx.Value(KeyAuthUserID).(int64)
     query, args, err := buildQuery(`
-        SELECT id, email, username, followers_count, followees_count, avatars
+        SELECT id, email, username, avatar, followers_count, followees_count, posts_count, likes_given_count, comments_count
         {{if .auth}}
         , followers.follower_id IS NOT NULL AS following
         , followees.followee_id IS NOT NULL AS followeed
@@ -308,7 +350,7 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
     for rows.Next() {
         var u UserProfile
         var avatar sql.NullString
-        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FolloweesCount, &u.FolloweesCount}
+        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount, &u.PostsCount, &u.LikesGivenCount, &u.CommentsCount}
         if auth {
             dest = append(dest, &u.Following, &u.Followeed)
         }
@@ -332,18 +374,21 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
     return uu, nil
 }
 
-//Followers in asc order with forward pagination
-func (s *Service) Followers(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
+//Followers with forward pagination, sorted alphabetically by username or by the most recent follow.
+func (s *Service) Followers(ctx context.Context, username, sort string, first int, after string) ([]UserProfile, error) {
     username = strings.TrimSpace(username)
     if !rxUsername.MatchString(username) {
         return nil, ErrInvalidUsername
     }
-
+    sort, err := normalizeFollowsSort(sort)
+    if err != nil {
+        return nil, err
+    }
     after = strings.TrimSpace(after)
     first = normalizePageSize(first)
     uid, auth := ctx.Value(KeyAuthUserID).(int64)
     query, args, err := buildQuery(`
-        SELECT id, email, username, followers_count, followees_count, avatar
+        SELECT id, email, username, avatar, followers_count, followees_count, posts_count, likes_given_count, comments_count, follows.created_at
         {{if .auth}}
         , followers.follower_id IS NOT NULL AS following
         , followees.followee_id IS NOT NULL AS followeed
@@ -355,12 +400,27 @@ func (s *Service) Followers(ctx context.Context, username string, first int, aft
         LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
         {{end}}
         WHERE follows.followee_id = (SELECT id from users where username = @username)
-        {{if  .after}}AND username > @after{{end}}
+        {{if .after}}
+        {{if eq .sort "recent"}}
+        AND (follows.created_at, username) < (
+            SELECT after_follows.created_at, after_users.username FROM follows AS after_follows
+            INNER JOIN users AS after_users ON after_follows.follower_id = after_users.id
+            WHERE after_users.username = @after AND after_follows.followee_id = follows.followee_id
+        )
+        {{else}}
+        AND username > @after
+        {{end}}
+        {{end}}
+        {{if eq .sort "recent"}}
+        ORDER BY follows.created_at DESC, username DESC
+        {{else}}
         ORDER BY username ASC
+        {{end}}
         LIMIT @first`, map[string]interface{}{
         "auth":     auth,
         "uid":      uid,
         "username": username,
+        "sort":     sort,
         "first":    first,
         "after":    after,
     })
@@ -377,7 +437,7 @@ func (s *Service) Followers(ctx context.Context, username string, first int, aft
     for rows.Next() {
         var u UserProfile
         var avatar sql.NullString
-        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FolloweesCount, &u.FolloweesCount}
+        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount, &u.PostsCount, &u.LikesGivenCount, &u.CommentsCount, &u.FollowedAt}
         if auth {
             dest = append(dest, &u.Following, &u.Followeed)
         }
@@ -419,17 +479,21 @@ func (s *Service) userByID(ctx context.Context, id int64) (User, error) {
     return u, nil
 }
 
-//Followees in asc order with forward pagination
-func (s *Service) Followees(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
+//Followees with forward pagination, sorted alphabetically by username or by the most recent follow.
+func (s *Service) Followees(ctx context.Context, username, sort string, first int, after string) ([]UserProfile, error) {
     username = strings.TrimSpace(username)
     if !rxUsername.MatchString(username) {
         return nil, ErrInvalidUsername
     }
+    sort, err := normalizeFollowsSort(sort)
+    if err != nil {
+        return nil, err
+    }
     after = strings.TrimSpace(after)
     first = normalizePageSize(first)
     uid, auth := ctx.Value(KeyAuthUserID).(int64)
     query, args, err := buildQuery(`
-        SELECT id, email, username, followers_count, followees_count, avatar
+        SELECT id, email, username, avatar, followers_count, followees_count, posts_count, likes_given_count, comments_count, follows.created_at
         {{if .auth}}
         , followers.follower_id IS NOT NULL AS following
         , followees.followee_id IS NOT NULL AS followeed
@@ -441,12 +505,27 @@ func (s *Service) Followees(ctx context.Context, username string, first int, aft
         LEFT JOIN follows AS followees ON followees.follower_id = users.id AND followees.followee_id = @uid
         {{end}}
         WHERE follows.follower_id = (SELECT id from users where username = @username)
-        {{if  .after}}AND username > @after{{end}}
+        {{if .after}}
+        {{if eq .sort "recent"}}
+        AND (follows.created_at, username) < (
+            SELECT after_follows.created_at, after_users.username FROM follows AS after_follows
+            INNER JOIN users AS after_users ON after_follows.followee_id = after_users.id
+            WHERE after_users.username = @after AND after_follows.follower_id = follows.follower_id
+        )
+        {{else}}
+        AND username > @after
+        {{end}}
+        {{end}}
+        {{if eq .sort "recent"}}
+        ORDER BY follows.created_at DESC, username DESC
+        {{else}}
         ORDER BY username ASC
+        {{end}}
         LIMIT @first`, map[string]interface{}{
         "auth":     auth,
         "uid":      uid,
         "username": username,
+        "sort":     sort,
         "first":    first,
         "after":    after,
     })
@@ -463,7 +542,7 @@ func (s *Service) Followees(ctx context.Context, username string, first int, aft
     for rows.Next() {
         var u UserProfile
         var avatar sql.NullString
-        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FolloweesCount, &u.FolloweesCount}
+        dest := []interface{}{&u.ID, &u.Email, &u.Username, &avatar, &u.FollowersCount, &u.FolloweesCount, &u.PostsCount, &u.LikesGivenCount, &u.CommentsCount, &u.FollowedAt}
         if auth {
             dest = append(dest, &u.Following, &u.Followeed)
         }
@@ -486,3 +565,14 @@ func (s *Service) Followees(ctx context.Context, username string, first int, aft
     }
     return uu, nil
 }
+
+// normalizeFollowsSort defaults to alphabetical order, and rejects unknown sorts.
+func normalizeFollowsSort(sort string) (string, error) {
+    switch sort = strings.TrimSpace(sort); sort {
+    case "":
+        return FollowsSortAlphabetical, nil
+    case FollowsSortAlphabetical, FollowsSortRecent:
+        return sort, nil
+    }
+    return "", ErrInvalidFollowsSort
+}
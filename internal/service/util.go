@@ -5,13 +5,16 @@ import (
     "fmt"
     "regexp"
     "strings"
+    "sync"
     "text/template"
 
     "github.com/lib/pq"
 )
 
 var queriesCache = make(map[string]*template.Template)
+var queriesCacheMu sync.Mutex
 var rxMentions = regexp.MustCompile(`\B@([a-zA-Z][a-zA-Z0-9_-]{0,17})`)
+var rxHashtags = regexp.MustCompile(`\B#([\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
 
 const (
     minPageSize     = 1
@@ -28,15 +31,18 @@ func isForeignKeyViolation(err error) bool {
     return ok && pgerr.Code == "23503"
 }
 func buildQuery(text string, data map[string]interface{}) (string, []interface{}, error) {
+    queriesCacheMu.Lock()
     t, ok := queriesCache[text]
     if !ok {
         var err error
         t, err = template.New("query").Parse(text)
         if err != nil {
+            queriesCacheMu.Unlock()
             return "", nil, fmt.Errorf("Couldn't parse sql query tempalte: %v", err)
         }
         queriesCache[text] = t
     }
+    queriesCacheMu.Unlock()
     var wr bytes.Buffer
     if err := t.Execute(&wr, data); err != nil {
         return "", nil, fmt.Errorf("Couldn't apply sql query data: %v", err)
@@ -64,15 +70,24 @@ func normalizePageSize(i int) int {
     }
     return i
 }
-func collectMentions(s string) []string {
+
+// collectHashtags returns the distinct normalized hashtags of the given text.
+func collectHashtags(s string) []string {
     m := map[string]struct{}{}
-    u := []string{}
-    for _, submatch := range rxMentions.FindAllStringSubmatch(s, -1) {
-        val := submatch[1]
+    tt := []string{}
+    for _, submatch := range rxHashtags.FindAllStringSubmatch(s, -1) {
+        val := normalizeHashtag(submatch[1])
+        if len([]rune(val)) > maxHashtagLength {
+            continue
+        }
         if _, ok := m[val]; !ok {
             m[val] = struct{}{}
-            u = append(u, val)
+            tt = append(tt, val)
         }
     }
-    return u
+    return tt
+}
+
+func normalizeHashtag(tag string) string {
+    return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
 }
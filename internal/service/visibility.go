@@ -0,0 +1,98 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+
+    "github.com/lib/pq"
+)
+
+const (
+    //VisibilityPublic posts are seen by everyone and show up everywhere.
+    VisibilityPublic = "public"
+    //VisibilityFollowers posts are only seen by the author followers.
+    VisibilityFollowers = "followers"
+    //VisibilityDirect posts are only seen by the users mentioned in them.
+    VisibilityDirect = "direct"
+    //VisibilityUnlisted posts are seen by everyone but left out of search, hashtags and trends.
+    VisibilityUnlisted = "unlisted"
+)
+
+// postVisibilityCondition is the SQL condition telling whether the posts row is within the audience of the viewer,
+// given as the format argument so it can be a query parameter or a column. The author is always in the audience.
+const postVisibilityCondition = `(
+    posts.visibility IN ('public', 'unlisted')
+    OR posts.user_id = %[1]s
+    OR (posts.visibility = 'followers' AND EXISTS (
+        SELECT 1 FROM follows AS viewer_follows
+        WHERE viewer_follows.follower_id = %[1]s AND viewer_follows.followee_id = posts.user_id
+    ))
+    OR (posts.visibility = 'direct' AND EXISTS (
+        SELECT 1 FROM post_mentions AS viewer_mentions
+        WHERE viewer_mentions.post_id = posts.id AND viewer_mentions.user_id = %[1]s
+    ))
+)`
+
+var (
+    //ErrInvalidVisibility is used to indicate that the visibility isn't one of public, followers, direct or unlisted.
+    ErrInvalidVisibility = errors.New("visibility must be one of public, followers, direct or unlisted")
+)
+
+// visibleTo returns the condition of the posts row being within the audience of the viewer.
+func visibleTo(viewer string) string {
+    return fmt.Sprintf(postVisibilityCondition, viewer)
+}
+
+func normalizeVisibility(visibility string) (string, error) {
+    switch visibility {
+    case "":
+        return VisibilityPublic, nil
+    case VisibilityPublic, VisibilityFollowers, VisibilityDirect, VisibilityUnlisted:
+        return visibility, nil
+    }
+    return "", ErrInvalidVisibility
+}
+
+type queryRower interface {
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// postVisible tells whether the post exists and the user, zero when unauthenticated, is within its audience.
+// Direct posts are never visible for resharing, as quoting or reposting would leak them out of their audience.
+func postVisible(ctx context.Context, db queryRower, postID, uid int64, resharing bool) (bool, error) {
+    var visible bool
+    query := "SELECT EXISTS (SELECT 1 FROM posts WHERE posts.id = $1 AND " + visibleTo("$2")
+    if resharing {
+        query += " AND (posts.visibility != 'direct' OR posts.user_id = $2)"
+    }
+    query += ")"
+    if err := db.QueryRowContext(ctx, query, postID, uid).Scan(&visible); err != nil {
+        return false, fmt.Errorf("couldn't query post visibility: %v", err)
+    }
+    return visible, nil
+}
+
+// linkMentions stores the users mentioned in the post, they're the audience of direct posts.
+func linkMentions(ctx context.Context, tx *sql.Tx, postID int64, entities []Entity) error {
+    mentions := mentionedUserIDs(entities)
+    if len(mentions) == 0 {
+        return nil
+    }
+    query := `
+        INSERT INTO post_mentions (post_id, user_id)
+        SELECT $1, id FROM users WHERE id = ANY($2)
+        ON CONFLICT DO NOTHING`
+    if _, err := tx.ExecContext(ctx, query, postID, pq.Array(mentions)); err != nil {
+        return fmt.Errorf("couldn't insert post mentions: %v", err)
+    }
+    return nil
+}
+
+func unlinkMentions(ctx context.Context, tx *sql.Tx, postID int64) error {
+    if _, err := tx.ExecContext(ctx, "DELETE FROM post_mentions WHERE post_id = $1", postID); err != nil {
+        return fmt.Errorf("couldn't delete post mentions: %v", err)
+    }
+    return nil
+}
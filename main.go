@@ -1,11 +1,14 @@
 package main
 
 import (
+    "context"
     "database/sql"
+    "flag"
     "log"
     "net/http"
     "os"
     "strconv"
+    "time"
 
     "github.com/joho/godotenv"
     _ "github.com/lib/pq"
@@ -14,6 +17,8 @@ import (
 )
 
 func main() {
+    repairCounters := flag.Bool("repair-counters", false, "recompute the denormalized counters from their source tables and exit")
+    flag.Parse()
     godotenv.Load()
     var (
         port         = env("PORT", "3000")
@@ -22,9 +27,18 @@ func main() {
         secretKey    = env("SECRET_KEY", "supersecretkeyyoushouldnotcommit")
         smtpHost     = env("SMTP_HOST", "smtp.mailtrap.io")
         smtpPort     = intEnv("SMTP_PORT", 25)
+
+        countersReconciliationInterval = intEnv("COUNTERS_RECONCILIATION_INTERVAL_MINUTES", 360)
+        countersReconciliationSample   = intEnv("COUNTERS_RECONCILIATION_SAMPLE", 1000)
+        postEditWindow                 = intEnv("POST_EDIT_WINDOW_MINUTES", 30)
+        trendsInterval                 = intEnv("TRENDS_INTERVAL_MINUTES", 5)
+    )
+    // Repairing the counters sends no mail.
+    var smtpUsername, smtpPassword string
+    if !*repairCounters {
         smtpUsername = mustEnv("SMTP_USERNAME")
         smtpPassword = mustEnv("SMTP_PASSWORD")
-    )
+    }
     db, err := sql.Open("postgres", databaseURL)
     if err != nil {
         log.Fatalf("couldn't open db connection: %v \n", err)
@@ -43,7 +57,18 @@ func main() {
         SMTPPort:     smtpPort,
         SMTPPassword: smtpPassword,
         SMTPUsername: smtpUsername,
+
+        CountersReconciliationInterval: time.Duration(countersReconciliationInterval) * time.Minute,
+        CountersReconciliationSample:   countersReconciliationSample,
+        PostEditWindow:                 time.Duration(postEditWindow) * time.Minute,
+        TrendsInterval:                 time.Duration(trendsInterval) * time.Minute,
+        DisableWorkers:                 *repairCounters,
     })
+    if *repairCounters {
+        r := s.RepairCounters(context.Background())
+        log.Printf("repaired %d counters with %d errors\n", len(r.Corrections), len(r.Errors))
+        return
+    }
     h := handler.New(s)
     if err = http.ListenAndServe(":"+port, h); err != nil {
         log.Fatalf("Couldn't start server: %v\n", err)
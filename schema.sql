@@ -6,15 +6,39 @@ CREATE TABLE IF NOT EXISTS users (
     email VARCHAR NOT NULL UNIQUE,
     username VARCHAR NOT NULL UNIQUE,
     avatar VARCHAR,
+    role VARCHAR NOT NULL DEFAULT 'user',
     followers_count INT NOT NULL DEFAULT 0 CHECK (followers_count >= 0),
-    followees_count INT NOT NULL DEFAULT 0 CHECK (followees_count >= 0)
+    followees_count INT NOT NULL DEFAULT 0 CHECK (followees_count >= 0),
+    posts_count INT NOT NULL DEFAULT 0 CHECK (posts_count >= 0),
+    likes_given_count INT NOT NULL DEFAULT 0 CHECK (likes_given_count >= 0),
+    comments_count INT NOT NULL DEFAULT 0 CHECK (comments_count >= 0),
+    nsfw_preference VARCHAR NOT NULL DEFAULT 'blur',
+    expand_spoilers BOOLEAN NOT NULL DEFAULT false
 
 )
 CREATE TABLE IF NOT EXISTS follows (
   follower_id INT NOT NULL REFERENCES users,
   followee_id INT NOT NULL REFERENCES users,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
   PRIMARY KEY (follower_id, followee_id)
 )
+CREATE INDEX IF NOT EXISTS sorted_followers ON follows (followee_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS sorted_followees ON follows (follower_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS follow_imports (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    total INT NOT NULL,
+    processed INT NOT NULL DEFAULT 0,
+    followed INT NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    failed_usernames VARCHAR[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ,
+    usernames VARCHAR[] NOT NULL DEFAULT '{}',
+    lease_expires_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
 
 CREATE TABLE IF NOT EXISTS posts (
    id SERIAL NOT NULL PRIMARY KEY,
@@ -24,22 +48,174 @@ CREATE TABLE IF NOT EXISTS posts (
    nsfw BOOLEAN NOT NULL,
    likes_count INT NOT NULL DEFAULT 0 CHECK (likes_count >= 0),
    comments_count INT NOT NULL DEFAULT 0 CHECK (comments_count >= 0),
-   created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+   reposts_count INT NOT NULL DEFAULT 0 CHECK (reposts_count >= 0),
+   quotes_count INT NOT NULL DEFAULT 0 CHECK (quotes_count >= 0),
+   quoted_post_id INT,
+   in_reply_to_post_id INT REFERENCES posts ON DELETE SET NULL,
+   conversation_id INT,
+   link_preview_url VARCHAR,
+   visibility VARCHAR NOT NULL DEFAULT 'public',
+   entities JSONB NOT NULL DEFAULT '[]',
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   edited_at TIMESTAMPTZ
 )
 CREATE INDEX IF NOT EXISTS sorted_posts ON posts(created_at DESC);
+CREATE INDEX IF NOT EXISTS posts_search ON posts USING GIN (to_tsvector('english', content));
+CREATE INDEX IF NOT EXISTS post_quotes ON posts(quoted_post_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS post_replies ON posts(in_reply_to_post_id, id);
+CREATE INDEX IF NOT EXISTS post_conversations ON posts(conversation_id);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pinned_post_id INT REFERENCES posts ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS media (
+   id SERIAL NOT NULL PRIMARY KEY,
+   user_id INT NOT NULL REFERENCES users,
+   post_id INT REFERENCES posts ON DELETE SET NULL,
+   position INT NOT NULL DEFAULT 0,
+   filename VARCHAR NOT NULL,
+   thumbnail VARCHAR NOT NULL,
+   width INT NOT NULL,
+   height INT NOT NULL,
+   alt_text VARCHAR NOT NULL DEFAULT '',
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS post_media ON media (post_id, position);
+CREATE INDEX IF NOT EXISTS unattached_media ON media (created_at) WHERE post_id IS NULL;
+
+CREATE TABLE IF NOT EXISTS link_previews (
+   url VARCHAR NOT NULL PRIMARY KEY,
+   title VARCHAR NOT NULL,
+   description VARCHAR NOT NULL,
+   site_name VARCHAR NOT NULL,
+   image VARCHAR,
+   ok BOOLEAN NOT NULL,
+   fetched_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS hashtags (
+   id SERIAL NOT NULL PRIMARY KEY,
+   name VARCHAR NOT NULL UNIQUE,
+   usage_count INT NOT NULL DEFAULT 0 CHECK (usage_count >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS post_hashtags (
+   post_id INT NOT NULL REFERENCES posts,
+   hashtag_id INT NOT NULL REFERENCES hashtags,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   PRIMARY KEY (post_id, hashtag_id)
+);
+CREATE INDEX IF NOT EXISTS sorted_hashtag_posts ON post_hashtags (hashtag_id, post_id DESC);
+
+CREATE TABLE IF NOT EXISTS post_phrases (
+   post_id INT NOT NULL REFERENCES posts,
+   phrase VARCHAR NOT NULL,
+   PRIMARY KEY (post_id, phrase)
+);
+
+CREATE TABLE IF NOT EXISTS post_mentions (
+   post_id INT NOT NULL REFERENCES posts,
+   user_id INT NOT NULL REFERENCES users,
+   PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS polls (
+   post_id INT NOT NULL PRIMARY KEY REFERENCES posts,
+   ends_at TIMESTAMPTZ NOT NULL,
+   ended BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS pending_polls ON polls (ends_at) WHERE NOT ended;
+
+CREATE TABLE IF NOT EXISTS poll_options (
+   id SERIAL NOT NULL PRIMARY KEY,
+   post_id INT NOT NULL REFERENCES polls,
+   position INT NOT NULL,
+   text VARCHAR NOT NULL,
+   votes_count INT NOT NULL DEFAULT 0 CHECK (votes_count >= 0)
+);
+CREATE INDEX IF NOT EXISTS poll_options_by_post ON poll_options (post_id, position);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+   post_id INT NOT NULL REFERENCES polls,
+   user_id INT NOT NULL REFERENCES users,
+   option_id INT NOT NULL REFERENCES poll_options,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS post_engagements (
+   kind VARCHAR NOT NULL,
+   post_id INT NOT NULL REFERENCES posts,
+   user_id INT NOT NULL REFERENCES users,
+   day DATE NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   PRIMARY KEY (post_id, kind, user_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS post_edits (
+   id SERIAL NOT NULL PRIMARY KEY,
+   post_id INT NOT NULL REFERENCES posts,
+   content VARCHAR NOT NULL,
+   spoiler_of VARCHAR,
+   nsfw BOOLEAN NOT NULL,
+   edited_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS post_edits_by_post ON post_edits (post_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS scheduled_posts (
+   id SERIAL NOT NULL PRIMARY KEY,
+   user_id INT NOT NULL REFERENCES users,
+   content VARCHAR NOT NULL,
+   spoiler_of VARCHAR,
+   nsfw BOOLEAN NOT NULL,
+   quoted_post_id INT,
+   in_reply_to_post_id INT,
+   media_ids INT[] NOT NULL DEFAULT '{}',
+   poll_options VARCHAR[],
+   poll_duration_minutes INT,
+   visibility VARCHAR NOT NULL DEFAULT 'public',
+   publish_at TIMESTAMPTZ NOT NULL,
+   status VARCHAR NOT NULL DEFAULT 'scheduled',
+   post_id INT REFERENCES posts ON DELETE SET NULL,
+   fanout_pending BOOLEAN NOT NULL DEFAULT false,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS due_scheduled_posts ON scheduled_posts (status, publish_at);
+CREATE INDEX IF NOT EXISTS sorted_user_scheduled_posts ON scheduled_posts (user_id, publish_at);
+
+CREATE TABLE IF NOT EXISTS drafts (
+   id SERIAL NOT NULL PRIMARY KEY,
+   user_id INT NOT NULL REFERENCES users,
+   content VARCHAR NOT NULL DEFAULT '',
+   spoiler_of VARCHAR,
+   nsfw BOOLEAN NOT NULL DEFAULT false,
+   media_ids INT[] NOT NULL DEFAULT '{}',
+   version INT NOT NULL DEFAULT 1,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS sorted_user_drafts ON drafts (user_id, updated_at DESC, id DESC);
 
 CREATE TABLE IF NOT EXISTS timeline (
    id SERIAL NOT NULL PRIMARY KEY,
    user_id INT NOT NULL REFERENCES users,
-   post_id INT NOT NULL REFERENCES posts
+   post_id INT NOT NULL REFERENCES posts,
+   reposted_by_id INT REFERENCES users
 )
 CREATE UNIQUE INDEX IF NOT EXISTS timeline_unique ON timeline (user_id, post_id);
 
+CREATE TABLE IF NOT EXISTS reposts (
+   user_id INT NOT NULL REFERENCES users,
+   post_id INT NOT NULL REFERENCES posts,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   PRIMARY KEY (user_id, post_id)
+);
+
 CREATE TABLE IF NOT EXISTS post_likes (
    user_id INT NOT NULL REFERENCES users,
    post_id INT NOT NULL REFERENCES posts,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
    PRIMARY KEY (user_id, post_id)
 )
+CREATE INDEX IF NOT EXISTS sorted_post_likes ON post_likes (post_id, created_at DESC);
 
 
 CREATE TABLE IF NOT EXISTS post_subscriptions (
@@ -49,20 +225,32 @@ CREATE TABLE IF NOT EXISTS post_subscriptions (
 )
 
 
+CREATE TABLE IF NOT EXISTS bookmarks (
+   user_id INT NOT NULL REFERENCES users,
+   post_id INT NOT NULL REFERENCES posts,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   PRIMARY KEY (user_id, post_id)
+);
+CREATE INDEX IF NOT EXISTS sorted_user_bookmarks ON bookmarks (user_id, created_at DESC, post_id DESC);
+
 CREATE TABLE IF NOT EXISTS comments (
    id SERIAL NOT NULL PRIMARY KEY,
    user_id INT NOT NULL REFERENCES users,
    post_id INT NOT NULL REFERENCES posts,
    content VARCHAR NOT NULL,
    likes_count INT NOT NULL DEFAULT 0 CHECK (likes_count >= 0),
+   link_preview_url VARCHAR,
+   entities JSONB NOT NULL DEFAULT '[]',
    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
 )
 
 CREATE TABLE IF NOT EXISTS comment_likes (
    user_id INT NOT NULL REFERENCES users,
    comment_id INT NOT NULL REFERENCES comments,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
    PRIMARY KEY (user_id, comment_id)
 )
+CREATE INDEX IF NOT EXISTS sorted_comment_likes ON comment_likes (comment_id, created_at DESC);
 
 CREATE TABLE IF NOT EXISTS notifications (
      id SERIAL NOT NULL PRIMARY KEY,
@@ -75,7 +263,30 @@ CREATE TABLE IF NOT EXISTS notifications (
  );
 
 CREATE INDEX IF NOT EXISTS sorted_notifications ON notifications (issued_at DESC);
-CREATE INDEX IF NOT EXISTS unique_notifications ON notifications (user_id, type, post_id, read);
+CREATE UNIQUE INDEX IF NOT EXISTS unique_notifications ON notifications (user_id, type, post_id) WHERE NOT read;
+CREATE TABLE IF NOT EXISTS lists (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users,
+    name VARCHAR NOT NULL,
+    private BOOLEAN NOT NULL DEFAULT false,
+    members_count INT NOT NULL DEFAULT 0 CHECK (members_count >= 0),
+    subscribers_count INT NOT NULL DEFAULT 0 CHECK (subscribers_count >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS list_members (
+    list_id INT NOT NULL REFERENCES lists,
+    user_id INT NOT NULL REFERENCES users,
+    PRIMARY KEY (list_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS list_members_by_user ON list_members (user_id);
+
+CREATE TABLE IF NOT EXISTS list_subscriptions (
+    user_id INT NOT NULL REFERENCES users,
+    list_id INT NOT NULL REFERENCES lists,
+    PRIMARY KEY (user_id, list_id)
+);
+
 CREATE TABLE IF NOT EXISTS verification_codes (
   id UUID NOT NULL PRIMARY KEY DEFAULT gen_random_uuid(),
   user_id INT NOT NULL REFERENCES users,